@@ -8,10 +8,7 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
-	"go/parser"
-	"go/printer"
 	"go/scanner"
-	"go/token"
 	"io"
 	"io/ioutil"
 	"os"
@@ -20,52 +17,120 @@ import (
 	"runtime/pprof"
 	"strings"
 
+	"github.com/pkg/errors"
+
 	"github.com/ashanbrown/gofmts/cmd/gofmts/internal/diff"
+	"github.com/ashanbrown/gofmts/pkg/gofmts"
 )
 
 var (
 	write     = flag.Bool("w", false, "re-write files")
 	list      = flag.Bool("l", false, "list")
 	doDiff    = flag.Bool("d", false, "display diffs instead of rewriting files")
+	check     = flag.Bool("check", false, "list files that need formatting and the issues in them and exit with status 1 if there are any")
 	allErrors = flag.Bool("e", false, "report all errors (not just the first 10 on different lines)")
+	jobs      = flag.Int("j", runtime.GOMAXPROCS(0), "number of files to process concurrently")
 
 	// debugging
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to this file")
 )
 
-// Keep these in sync with go/format/format.go.
-const (
-	tabWidth    = 8
-	printerMode = printer.UseSpaces | printer.TabIndent | printerNormalizeNumbers
-
-	// printerNormalizeNumbers means to canonicalize number literal prefixes
-	// and exponents while printing. See https://golang.org/doc/go1.13#gofmt.
-	//
-	// This value is defined in go/printer specifically for go/format and cmd/gofmt.
-	printerNormalizeNumbers = 1 << 30
-)
-
-var (
-	fileSet    = token.NewFileSet() // per process FileSet
-	exitCode   = 0
-	parserMode parser.Mode
-)
+var exitCode = 0
 
 func report(err error) {
 	scanner.PrintError(os.Stderr, err)
 	exitCode = 2
 }
 
-func usage() {
-	fmt.Fprintf(os.Stderr, "usage: gofmts [flags] [path ...]\n")
-	flag.PrintDefaults()
+// reporter collects the output and errors for a single file, so that files processed concurrently are reported in
+// the order in which they were given
+type reporter struct {
+	out          bytes.Buffer
+	errOut       bytes.Buffer
+	failed       bool
+	needsChanges bool // the file isn't formatted, which is only an error in check mode
+	issues       []gofmts.Issue
+}
+
+func (r *reporter) report(err error) {
+	if err != errIssuesReported {
+		scanner.PrintError(&r.errOut, err)
+	}
+	r.failed = true
+}
+
+// errIssuesReported stops processing a file whose issues can't be fixed, once they have been recorded for output
+var errIssuesReported = errors.New("issues reported")
+
+// addIssues records the issues found in a file.  Issues that can't be fixed are errors, which are returned as text
+// unless issues are being written in another format.
+func (r *reporter) addIssues(issues []gofmts.Issue) error {
+	errList := scanner.ErrorList{}
+	for _, i := range issues {
+		r.issues = append(r.issues, i)
+		if _, hasReplacement := i.(gofmts.IssueWithReplacement); !hasReplacement {
+			errList.Add(i.Position(), i.Details())
+		}
+	}
+	if len(errList) > 0 && *outputFormat != textFormat {
+		return errIssuesReported
+	}
+	return errList.Err()
+}
+
+// flush writes the output for a file and updates the exit code, giving errors precedence over files needing changes
+func (r *reporter) flush() {
+	os.Stdout.Write(r.out.Bytes())
+	os.Stderr.Write(r.errOut.Bytes())
+	reportedIssues = append(reportedIssues, r.issues...)
+	switch {
+	case r.failed:
+		exitCode = 2
+	case r.needsChanges && *check && exitCode == 0:
+		exitCode = 1
+	}
+}
+
+// sequencer runs up to a fixed number of tasks at a time and writes their output in the order they were added
+type sequencer struct {
+	sem  chan struct{}
+	prev <-chan struct{} // closed once the output of the last task added has been written
 }
 
-func initParserMode() {
-	parserMode = parser.ParseComments
-	if *allErrors {
-		parserMode |= parser.AllErrors
+func newSequencer(maxJobs int) *sequencer {
+	if maxJobs < 1 {
+		maxJobs = 1
 	}
+	done := make(chan struct{})
+	close(done)
+	return &sequencer{sem: make(chan struct{}, maxJobs), prev: done}
+}
+
+// Add schedules "task", blocking until there is a free slot to run it
+func (s *sequencer) Add(task func(r *reporter)) {
+	s.sem <- struct{}{}
+	prev := s.prev
+	ready := make(chan struct{})
+	s.prev = ready
+	go func() {
+		r := &reporter{}
+		task(r)
+		<-s.sem
+		<-prev
+		r.flush()
+		close(ready)
+	}()
+}
+
+// Wait waits for all tasks to finish and their output to be written
+func (s *sequencer) Wait() {
+	<-s.prev
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gofmts [flags] [path ...]\n")
+	fmt.Fprintf(os.Stderr, "       gofmts [-config file] lsp\n")
+	flag.PrintDefaults()
 }
 
 func isGoFile(f os.FileInfo) bool {
@@ -82,10 +147,6 @@ func main() {
 	os.Exit(exitCode)
 }
 
-func walkDir(path string) {
-	filepath.Walk(path, visitFile)
-}
-
 func gofmtsMain() {
 	flag.Usage = usage
 	flag.Parse()
@@ -102,7 +163,34 @@ func gofmtsMain() {
 		defer pprof.StopCPUProfile()
 	}
 
-	initParserMode()
+	initBuildContext()
+
+	if err := initConfig(); err != nil {
+		report(err)
+		return
+	}
+
+	if flag.NArg() == 1 && flag.Arg(0) == "lsp" {
+		serveLanguageServer()
+		return
+	}
+
+	if *check && *write {
+		fmt.Fprintln(os.Stderr, "error: cannot use -w with -check")
+		exitCode = 2
+		return
+	}
+
+	if err := initOutputFormat(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		exitCode = 2
+		return
+	}
+	defer func() {
+		if err := writeIssues(os.Stdout, reportedIssues); err != nil {
+			report(err)
+		}
+	}()
 
 	if flag.NArg() == 0 {
 		if *write {
@@ -110,29 +198,55 @@ func gofmtsMain() {
 			exitCode = 2
 			return
 		}
-		if err := processFile("<standard input>", os.Stdin, os.Stdout, true); err != nil {
-			report(err)
+		r := &reporter{}
+		if err := processFile("<standard input>", os.Stdin, r, true, true); err != nil {
+			r.report(err)
 		}
+		r.flush()
 		return
 	}
 
+	seq := newSequencer(*jobs)
+	defer seq.Wait() // runs before the issues are written
 	for i := 0; i < flag.NArg(); i++ {
 		path := flag.Arg(i)
-		switch dir, err := os.Stat(path); {
-		case err != nil:
-			report(err)
-		case dir.IsDir():
-			walkDir(path)
-		default:
-			if err := processFile(path, nil, os.Stdout, false); err != nil {
-				report(err)
-			}
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			// files named explicitly are always formatted
+			seq.Add(func(r *reporter) {
+				if err := processFile(path, nil, r, false, true); err != nil {
+					r.report(err)
+				}
+			})
+			continue
+		}
+		files, err := packageFiles(path)
+		for _, filename := range files {
+			filename := filename
+			seq.Add(func(r *reporter) {
+				// Don't complain if a file was deleted in the meantime (i.e.
+				// the directory changed concurrently while running gofmt).
+				if err := processFile(filename, nil, r, false, *includeGenerated); err != nil && !os.IsNotExist(err) {
+					r.report(err)
+				}
+			})
+		}
+		if err != nil {
+			seq.Add(func(r *reporter) { r.report(err) })
 		}
 	}
 }
 
-// If in == nil, the source is the contents of the file with the given filename.
-func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error {
+// If in == nil, the source is the contents of the file with the given filename.  Files marked as generated are
+// skipped unless "generatedOk" is set.
+func processFile(filename string, in io.Reader, r *reporter, stdin bool, generatedOk bool) error {
+	cfg, err := loadConfig(filename)
+	if err != nil {
+		return err
+	}
+	if !stdin && cfg.Excludes(filename) {
+		return nil
+	}
+
 	var perm os.FileMode = 0644
 	if in == nil {
 		f, err := os.Open(filename)
@@ -152,23 +266,11 @@ func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error
 	if err != nil {
 		return err
 	}
-
-	file, sourceAdj, indentAdj, err := parse(fileSet, filename, src, stdin)
-	if err != nil {
-		return err
-	}
-
-	err = reformatFile(src, file)
-	if err != nil {
-		return err
+	if !generatedOk && isGenerated(src) {
+		return nil
 	}
 
-	formatted, err := format(fileSet, file, sourceAdj, indentAdj, src, printer.Config{Mode: printerMode, Tabwidth: tabWidth})
-	if err != nil {
-		return err
-	}
-
-	res, err := sortFile(formatted)
+	res, err := formatSource(r, filename, src, cfg, stdin)
 	if err != nil {
 		return err
 	}
@@ -176,8 +278,14 @@ func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error
 	// this section is all copied from gofmts
 	if !bytes.Equal(src, res) {
 		// formatting has changed
-		if *list {
-			fmt.Fprintln(out, filename)
+		r.needsChanges = true
+		if (*list || *check) && *outputFormat == textFormat {
+			fmt.Fprintln(&r.out, filename)
+		}
+		if *check && *outputFormat == textFormat {
+			for _, issue := range r.issues {
+				fmt.Fprintf(&r.out, "%s: %s\n", issue.Position(), issue.Details())
+			}
 		}
 		if *write {
 			// make a temporary backup before overwriting original
@@ -196,69 +304,36 @@ func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error
 			}
 		}
 		if *doDiff {
-			data, err := diffWithReplaceTempFile(src, res, filename)
-			if err != nil {
-				return fmt.Errorf("computing diff: %s", err)
-			}
-			fmt.Printf("diff -u %s %s\n", filepath.ToSlash(filename+".orig"), filepath.ToSlash(filename))
-			out.Write(data)
+			// always print filepath with slash separator
+			f := filepath.ToSlash(filename)
+			fmt.Fprintf(&r.out, "diff -u %s %s\n", f+".orig", f)
+			r.out.Write(diff.Diff(f+".orig", src, f, res))
 		}
 	}
 
-	if !*list && !*write && !*doDiff {
-		_, err = out.Write(res)
+	if !*list && !*write && !*doDiff && !*check && *outputFormat == textFormat {
+		_, err = r.out.Write(res)
 	}
 
 	return err
 }
 
-func visitFile(path string, f os.FileInfo, err error) error {
-	if err == nil && isGoFile(f) {
-		err = processFile(path, nil, os.Stdout, false)
-	}
-	// Don't complain if a file was deleted in the meantime (i.e.
-	// the directory changed concurrently while running gofmt).
-	if err != nil && !os.IsNotExist(err) {
-		report(err)
-	}
-	return nil
-}
-
-func diffWithReplaceTempFile(b1, b2 []byte, filename string) ([]byte, error) {
-	data, err := diff.Diff("gofmts", b1, b2)
-	if len(data) > 0 {
-		return replaceTempFilename(data, filename)
-	}
-	return data, err
-}
-
-// replaceTempFilename replaces temporary filenames in diff with actual one.
-//
-// --- /tmp/gofmt316145376	2017-02-03 19:13:00.280468375 -0500
-// +++ /tmp/gofmt617882815	2017-02-03 19:13:00.280468375 -0500
-// ...
-// ->
-// --- path/to/file.go.orig	2017-02-03 19:13:00.280468375 -0500
-// +++ path/to/file.go	2017-02-03 19:13:00.280468375 -0500
-// ...
-func replaceTempFilename(diff []byte, filename string) ([]byte, error) {
-	bs := bytes.SplitN(diff, []byte{'\n'}, 3)
-	if len(bs) < 3 {
-		return nil, fmt.Errorf("got unexpected diff for %s", filename)
-	}
-	// Preserve timestamps.
-	var t0, t1 []byte
-	if i := bytes.LastIndexByte(bs[0], '\t'); i != -1 {
-		t0 = bs[0][i:]
+// formatSource formats the strings in "src", formats it as gofmt does and then sorts it, recording the issues found
+func formatSource(r *reporter, filename string, src []byte, cfg *gofmts.Config, fragmentOk bool) ([]byte, error) {
+	res, issues, err := gofmts.Source(src, gofmts.Options{
+		Filename:  filename,
+		Config:    cfg,
+		Fragment:  fragmentOk,
+		NoTabStop: !*nextTabStop,
+		AllErrors: *allErrors,
+	})
+	if err != nil {
+		return nil, err
 	}
-	if i := bytes.LastIndexByte(bs[1], '\t'); i != -1 {
-		t1 = bs[1][i:]
+	if err := r.addIssues(issues); err != nil {
+		return nil, err
 	}
-	// Always print filepath with slash separator.
-	f := filepath.ToSlash(filename)
-	bs[0] = []byte(fmt.Sprintf("--- %s%s", f+".orig", t0))
-	bs[1] = []byte(fmt.Sprintf("+++ %s%s", f, t1))
-	return bytes.Join(bs, []byte{'\n'}), nil
+	return res, nil
 }
 
 const chmodSupported = runtime.GOOS != "windows"
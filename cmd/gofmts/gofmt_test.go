@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMainProcess isn't a real test.  It runs the command with the arguments that follow "--", for runGofmts.
+func TestMainProcess(t *testing.T) {
+	if os.Getenv("GOFMTS_WANT_MAIN_PROCESS") != "1" {
+		return
+	}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{"gofmts"}, os.Args[i+1:]...)
+			break
+		}
+	}
+	main()
+}
+
+// runGofmts runs the command in a separate process, since it keeps its flags and exit status in globals
+func runGofmts(t *testing.T, args ...string) (stdout, stderr string, exitCode int) {
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=TestMainProcess", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "GOFMTS_WANT_MAIN_PROCESS=1")
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else {
+		require.NoError(t, err)
+	}
+	return outBuf.String(), errBuf.String(), exitCode
+}
+
+// writeFiles writes files with the given contents, by slash-separated name, into a new directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	}
+	return dir
+}
+
+func TestJobs(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("f%02d.go", i)
+		switch {
+		case i == 17:
+			files[name] = "package p\n\nfunc {\n"
+		case i%3 == 0:
+			files[name] = fmt.Sprintf("package p\n\n//gofmts:json\nconst j%d = `[%d,2]`\n", i, i)
+		default:
+			files[name] = fmt.Sprintf("package p\n\nconst c%d = %d\n", i, i)
+		}
+	}
+	dir := writeFiles(t, files)
+
+	sequentialOut, sequentialErr, sequentialCode := runGofmts(t, "-l", "-j", "1", dir)
+	assert.Equal(t, 2, sequentialCode, "a file that can't be parsed is an error")
+	assert.Contains(t, sequentialOut, filepath.Join(dir, "f00.go")+"\n"+filepath.Join(dir, "f03.go")+"\n")
+	assert.Contains(t, sequentialErr, filepath.Join(dir, "f17.go"))
+
+	for _, j := range []string{"4", "16"} {
+		out, errOut, code := runGofmts(t, "-l", "-j", j, dir)
+		assert.Equal(t, sequentialOut, out, "-j %s", j)
+		assert.Equal(t, sequentialErr, errOut, "-j %s", j)
+		assert.Equal(t, sequentialCode, code, "-j %s", j)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("a formatted tree passes quietly", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{
+			"a.go":   "package a\n\n//gofmts:json\nconst j = `\n\t\t[1, 2]\n\t\t`\n",
+			"b/b.go": "package b\n\nconst (\n\t//gofmts:sort\n\tx = 1\n\ty = 2\n)\n",
+		})
+		out, errOut, code := runGofmts(t, "-check", dir+"/...")
+		assert.Equal(t, 0, code)
+		assert.Empty(t, out)
+		assert.Empty(t, errOut)
+	})
+
+	t.Run("files that need formatting are listed with their issues", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{
+			"a.go": "package a\n\n//gofmts:json\nconst j = `[1,2]`\n",
+			"b.go": "package a\n\nconst c = 1\n",
+		})
+		out, errOut, code := runGofmts(t, "-check", dir)
+		assert.Equal(t, 1, code)
+		assert.Equal(t, filepath.Join(dir, "a.go")+"\n"+filepath.Join(dir, "a.go")+":4:11: json formatting differs\n", out)
+		assert.Empty(t, errOut)
+		a, err := ioutil.ReadFile(filepath.Join(dir, "a.go"))
+		require.NoError(t, err)
+		assert.Equal(t, "package a\n\n//gofmts:json\nconst j = `[1,2]`\n", string(a), "nothing is written")
+	})
+
+	t.Run("issues that can't be fixed are errors", func(t *testing.T) {
+		dir := writeFiles(t, map[string]string{
+			"a.go": "package a\n\n//gofmts:json\nconst j = `[1,2]`\n",
+			"b.go": "package a\n\n//gofmts:graphql\nconst q = `{a}`\n",
+		})
+		out, errOut, code := runGofmts(t, "-check", dir)
+		assert.Equal(t, 2, code, "errors take precedence over files that need formatting")
+		assert.Contains(t, out, filepath.Join(dir, "a.go")+"\n")
+		assert.NotContains(t, out, "b.go")
+		assert.Equal(t, filepath.Join(dir, "b.go")+":3:17: unknown directive `gofmts:graphql`\n", errOut)
+	})
+}
@@ -2,64 +2,44 @@ package main
 
 import (
 	"flag"
-	"go/ast"
-	"go/printer"
-	"go/scanner"
-	"io/ioutil"
-
-	"github.com/pkg/errors"
+	"os"
 
+	"github.com/ashanbrown/gofmts/cmd/gofmts/internal/lsp"
 	"github.com/ashanbrown/gofmts/pkg/gofmts"
 )
 
 var (
+	configFile  = flag.String("config", "", "read formatter configuration from this file")
 	nextTabStop = flag.Bool("t", true, "position formatted strings at next tab stop")
 )
 
-func reformatFile(src []byte, file *ast.File) error {
-	if !*nextTabStop {
-		src = nil // if we don't send the source, we won't try to position formatted text at the next tab stop
+var explicitConfig *gofmts.Config // configuration given on the command-line
+
+func initConfig() error {
+	if *configFile == "" {
+		return nil
 	}
-	if err := handleIssues(gofmts.FormatFile(src, fileSet, file)); err != nil {
+	cfg, err := gofmts.LoadConfig(*configFile)
+	if err != nil {
 		return err
 	}
+	explicitConfig = cfg
 	return nil
 }
 
-func sortFile(src []byte) ([]byte, error) {
-	file, sourceAdj, indentAdj, err := parse(fileSet, "presorted", src, true)
-	if err != nil {
-		tmpfile, tmpfileErr := ioutil.TempFile("", "gofmts-presorted*.go")
-		if tmpfileErr != nil {
-			report(errors.Errorf("internal error: unable to write tempfile for presorted: %s", tmpfileErr))
-		} else {
-			report(errors.Errorf("internal error: writing temporary file for failed format prior to sort at %s", tmpfile.Name()))
-			if _, err := tmpfile.Write(src); err != nil {
-				report(errors.Errorf("internal error: unable to write to tempfile: %s", err))
-			}
-			if err := tmpfile.Close(); err != nil {
-				report(errors.Errorf("internal error: unable to write to tempfile: %s", err))
-			}
-		}
-		return nil, err
-	}
-
-	if err := handleIssues(gofmts.SortFile(fileSet, file)); err != nil {
-		return nil, err
+// loadConfig returns the configuration given on the command-line or, if there is none, the one found by searching up
+// the directory tree from "filename"
+func loadConfig(filename string) (*gofmts.Config, error) {
+	if explicitConfig != nil {
+		return explicitConfig, nil
 	}
-
-	return format(fileSet, file, sourceAdj, indentAdj, src, printer.Config{Mode: printerMode, Tabwidth: tabWidth})
+	return gofmts.FindConfig(filename)
 }
 
-func handleIssues(issues []gofmts.Issue, err error) error {
-	if err != nil {
-		return err
-	}
-	errList := scanner.ErrorList{}
-	for _, i := range issues {
-		if _, hasReplacement := i.(gofmts.IssueWithReplacement); !hasReplacement {
-			errList.Add(i.Position(), i.Details())
-		}
+// serveLanguageServer runs a language server over standard input and output
+func serveLanguageServer() {
+	server := &lsp.Server{Config: loadConfig}
+	if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+		report(err)
 	}
-	return errList.Err()
 }
@@ -1,58 +1,208 @@
-// Copyright 2019 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
-
-// Package diff implements a Diff function that compare two inputs
-// using the 'diff' tool.
+// Package diff implements a Diff function that compares two inputs
+// line by line and reports the differences in unified format,
+// like 'diff -u', without running an external tool.
 package diff
 
 import (
-	"io/ioutil"
-	"os"
-	"os/exec"
-	"runtime"
+	"bytes"
+	"fmt"
+)
+
+// context is the number of unchanged lines shown around each change
+const context = 3
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
 )
 
-// Returns diff of two arrays of bytes in diff tool format.
-func Diff(prefix string, b1, b2 []byte) ([]byte, error) {
-	f1, err := writeTempFile(prefix, b1)
-	if err != nil {
-		return nil, err
+// op is a single line of an edit script, along with the (0-based) lines of each input that it comes before
+type op struct {
+	kind         opKind
+	text         string
+	oldLine      int
+	newLine      int
+	noEndingLine bool // the line is the last of its input and has no newline
+}
+
+// Diff returns a unified diff of old and new, labeled with oldName and newName,
+// or nil if the inputs are identical.
+func Diff(oldName string, old []byte, newName string, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
 	}
-	defer os.Remove(f1)
+	ops := edits(splitLines(old), splitLines(new))
 
-	f2, err := writeTempFile(prefix, b2)
-	if err != nil {
-		return nil, err
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == opEqual {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk over following changes that are close enough for their context to overlap
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != opEqual {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == opEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				break
+			}
+			end = next
+		}
+		end += context
+		if end > len(ops) {
+			end = len(ops)
+		}
+		writeHunk(&out, ops[start:end])
+		i = end
 	}
-	defer os.Remove(f2)
+	return out.Bytes()
+}
 
-	cmd := "diff"
-	if runtime.GOOS == "plan9" {
-		cmd = "/bin/ape/diff"
+func writeHunk(out *bytes.Buffer, ops []op) {
+	var oldCount, newCount int
+	for _, o := range ops {
+		if o.kind != opInsert {
+			oldCount++
+		}
+		if o.kind != opDelete {
+			newCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(ops[0].oldLine, oldCount), hunkRange(ops[0].newLine, newCount))
+	for _, o := range ops {
+		out.WriteByte(byte(o.kind))
+		out.WriteString(o.text)
+		if o.noEndingLine {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
 	}
+}
 
-	data, err := exec.Command(cmd, "-u", f1, f2).CombinedOutput()
-	if len(data) > 0 {
-		// diff exits with a non-zero status when the files don't match.
-		// Ignore that failure as long as we get output.
-		err = nil
+// hunkRange formats the range of a hunk starting at the 0-based line "start" as diff does
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start) // an empty range is identified by the line before it
+	case 1:
+		return fmt.Sprintf("%d", start+1)
 	}
-	return data, err
+	return fmt.Sprintf("%d,%d", start+1, count)
 }
 
-func writeTempFile(prefix string, data []byte) (string, error) {
-	file, err := ioutil.TempFile("", prefix)
-	if err != nil {
-		return "", err
+// splitLines splits data into lines, each retaining its newline except possibly the last
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
 	}
-	_, err = file.Write(data)
-	if err1 := file.Close(); err == nil {
-		err = err1
+	return lines
+}
+
+// edits computes a shortest edit script from a to b with the algorithm from
+// Eugene W. Myers, "An O(ND) Difference Algorithm and Its Variations".
+func edits(a, b []string) []op {
+	n, m := len(a), len(b)
+
+	// trace records the furthest reaching x of each step d on the diagonals it can reach, which are k = -d, -d+2, ..., d
+	var trace [][]int
+	furthest := func(d, k int) int {
+		return trace[d][(k+d)/2]
+	}
+	// down reports whether the path to diagonal k at step d comes down from diagonal k+1, rather than right from k-1
+	down := func(d, k int) bool {
+		return k == -d || k != d && furthest(d-1, k-1) < furthest(d-1, k+1)
+	}
+	for d, done := 0, false; !done; d++ {
+		xs := make([]int, d+1)
+		trace = append(trace, xs)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			switch {
+			case d == 0:
+			case down(d, k):
+				x = furthest(d-1, k+1)
+			default:
+				x = furthest(d-1, k-1) + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			xs[(k+d)/2] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+	}
+
+	// walk back through the trace to recover the path
+	var reversed []op
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+		prevK := k - 1
+		if down(d, k) {
+			prevK = k + 1
+		}
+		prevX := furthest(d-1, prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, op{kind: opEqual, text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, op{kind: opInsert, text: b[y-1]})
+		} else {
+			reversed = append(reversed, op{kind: opDelete, text: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for ; x > 0; x-- {
+		reversed = append(reversed, op{kind: opEqual, text: a[x-1]})
 	}
-	if err != nil {
-		os.Remove(file.Name())
-		return "", err
+
+	ops := make([]op, len(reversed))
+	oldLine, newLine := 0, 0
+	for i := range reversed {
+		o := reversed[len(reversed)-1-i]
+		o.oldLine, o.newLine = oldLine, newLine
+		if o.kind != opInsert {
+			oldLine++
+			o.noEndingLine = oldLine == n && !hasNewline(o.text)
+		}
+		if o.kind != opDelete {
+			newLine++
+			o.noEndingLine = o.noEndingLine || newLine == m && !hasNewline(o.text)
+		}
+		ops[i] = o
 	}
-	return file.Name(), nil
+	return ops
+}
+
+func hasNewline(line string) bool {
+	return len(line) > 0 && line[len(line)-1] == '\n'
 }
@@ -0,0 +1,116 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("identical inputs have no diff", func(t *testing.T) {
+		assert.Nil(t, Diff("a.go.orig", []byte("a\nb\n"), "a.go", []byte("a\nb\n")))
+	})
+
+	t.Run("changes are shown with context and filename headers", func(t *testing.T) {
+		old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+		new := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+		assert.Equal(t, `--- a.go.orig
++++ a.go
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+@@ -13,3 +13,4 @@
+ 13
+ 14
+ 15
++16
+`, string(Diff("a.go.orig", []byte(old), "a.go", []byte(new))))
+	})
+
+	t.Run("nearby changes share a hunk", func(t *testing.T) {
+		assert.Equal(t, `--- a
++++ b
+@@ -1,5 +1,4 @@
+-a
++A
+ b
+ c
+-d
+ e
+`, string(Diff("a", []byte("a\nb\nc\nd\ne\n"), "b", []byte("A\nb\nc\ne\n"))))
+	})
+
+	t.Run("missing newlines at the end are marked", func(t *testing.T) {
+		assert.Equal(t, `--- a
++++ b
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`, string(Diff("a", []byte("a\nb"), "b", []byte("a\nb\n"))))
+	})
+
+	t.Run("empty inputs", func(t *testing.T) {
+		assert.Equal(t, "--- a\n+++ b\n@@ -0,0 +1 @@\n+a\n", string(Diff("a", nil, "b", []byte("a\n"))))
+	})
+
+	t.Run("edit scripts are as short as possible", func(t *testing.T) {
+		for _, c := range [][2]string{
+			{"abcabba", "cbabac"},
+			{"abc", "xyz"},
+			{"", "abc"},
+			{"aaaa", "aa"},
+			{"abcdefgh", "ahgfedcb"},
+			{"xaxbxcxd", "abcdyxyxyx"},
+		} {
+			a, b := strings.Split(c[0], ""), strings.Split(c[1], "")
+			if c[0] == "" {
+				a = nil
+			}
+			var oldLines, newLines []string
+			changes := 0
+			for _, o := range edits(a, b) {
+				if o.kind != opInsert {
+					oldLines = append(oldLines, o.text)
+				}
+				if o.kind != opDelete {
+					newLines = append(newLines, o.text)
+				}
+				if o.kind != opEqual {
+					changes++
+				}
+			}
+			assert.Equal(t, a, oldLines, c[0])
+			assert.Equal(t, b, newLines, c[1])
+			assert.Equal(t, len(a)+len(b)-2*longestCommonSubsequence(a, b), changes, "%s -> %s", c[0], c[1])
+		}
+	})
+}
+
+func longestCommonSubsequence(a, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] > lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	return lengths[0][0]
+}
@@ -0,0 +1,291 @@
+// Package lsp implements a language server that reports the issues found by gofmts as diagnostics and fixes them with
+// code actions and document formatting.
+package lsp
+
+import (
+	"encoding/json"
+	"go/scanner"
+	"io"
+	"net/url"
+	"path/filepath"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/ashanbrown/gofmts/pkg/gofmts"
+)
+
+// Server is a language server for a single client, speaking JSON-RPC over a pair of streams
+type Server struct {
+	// Config returns the configuration for a file, which may be nil
+	Config func(filename string) (*gofmts.Config, error)
+
+	conn      *conn
+	documents map[string]string // text of the open documents, by uri
+}
+
+// errExit stops the server when the client asks it to exit
+var errExit = errors.New("exit")
+
+// Serve handles messages from "in" until the client asks the server to exit or the input is closed
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.conn = newConn(in, out)
+	s.documents = make(map[string]string)
+	for {
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if rErr, ok := err.(*responseError); ok {
+			if err := s.conn.respond(nil, nil, rErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "" {
+			continue // we don't send requests, so there are no responses to handle
+		}
+		result, err := s.handle(msg.Method, msg.Params)
+		if err == errExit {
+			return nil
+		}
+		if msg.ID == nil {
+			continue // errors in notifications have nowhere to go
+		}
+		if err := s.conn.respond(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:           textDocumentSyncFull,
+				CodeActionProvider:         true,
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "gofmts"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "exit":
+		return nil, errExit
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		s.documents[p.TextDocument.URI] = p.TextDocument.Text
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// we ask for full document sync, so the last change holds the whole text
+		s.documents[p.TextDocument.URI] = p.ContentChanges[len(p.ContentChanges)-1].Text
+		return nil, s.publishDiagnostics(p.TextDocument.URI)
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		delete(s.documents, p.TextDocument.URI)
+		return nil, s.conn.notify("textDocument/publishDiagnostics",
+			publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}})
+	case "textDocument/codeAction":
+		var p codeActionParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.codeActions(p.TextDocument.URI, p.Range)
+	case "textDocument/formatting":
+		var p documentFormattingParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.formatting(p.TextDocument.URI)
+	case "initialized", "textDocument/didSave", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) publishDiagnostics(uri string) error {
+	diagnostics := []diagnostic{}
+	issues, err := s.issues(uri)
+	if err != nil {
+		return err
+	}
+	doc := newDocument(s.documents[uri])
+	for _, issue := range issues {
+		diagnostics = append(diagnostics, newDiagnostic(doc, issue))
+	}
+	return s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) codeActions(uri string, rng lspRange) ([]codeAction, error) {
+	actions := []codeAction{}
+	issues, err := s.issues(uri)
+	if err != nil {
+		return nil, err
+	}
+	doc := newDocument(s.documents[uri])
+	for _, issue := range issues {
+		fix, ok := issue.(gofmts.IssueWithReplacement)
+		if !ok {
+			continue
+		}
+		diag := newDiagnostic(doc, issue)
+		if !diag.Range.overlaps(rng) {
+			continue
+		}
+		actions = append(actions, codeAction{
+			Title:       "gofmts: fix " + issue.Details(),
+			Kind:        "quickfix",
+			Diagnostics: []diagnostic{diag},
+			Edit:        workspaceEdit{Changes: map[string][]textEdit{uri: {issueEdit(doc, fix)}}},
+		})
+	}
+	return actions, nil
+}
+
+// formatting returns an edit that makes all of the fixes at once.  Issues without fixes don't stop the others from
+// being made; they stay in the diagnostics published for the document.
+func (s *Server) formatting(uri string) ([]textEdit, error) {
+	text, ok := s.documents[uri]
+	if !ok {
+		return nil, errors.Errorf("document %s is not open", uri)
+	}
+	formatted, _, err := s.source(uri)
+	if err != nil {
+		return nil, err
+	}
+	if formatted == nil || string(formatted) == text {
+		return []textEdit{}, nil
+	}
+	doc := newDocument(text)
+	return []textEdit{{
+		Range:   lspRange{End: doc.position(len(text))},
+		NewText: string(formatted),
+	}}, nil
+}
+
+// issues finds the formatting and sorting issues in an open document
+func (s *Server) issues(uri string) ([]gofmts.Issue, error) {
+	_, issues, err := s.source(uri)
+	if _, isSyntaxError := err.(scanner.ErrorList); isSyntaxError {
+		return nil, nil // leave syntax errors to the go tools
+	}
+	return issues, err
+}
+
+// source formats an open document as the command does, returning nothing if the document isn't open or its file is
+// excluded by the configuration
+func (s *Server) source(uri string) ([]byte, []gofmts.Issue, error) {
+	text, ok := s.documents[uri]
+	if !ok {
+		return nil, nil, nil
+	}
+	filename := uriFilename(uri)
+	var cfg *gofmts.Config
+	if s.Config != nil {
+		var err error
+		if cfg, err = s.Config(filename); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.Excludes(filename) {
+		return nil, nil, nil
+	}
+	return gofmts.Source([]byte(text), gofmts.Options{Filename: filename, Config: cfg})
+}
+
+func newDiagnostic(doc *document, issue gofmts.Issue) diagnostic {
+	start := issue.Position().Offset
+	end := start
+	severity := severityError
+	if fix, ok := issue.(gofmts.IssueWithReplacement); ok {
+		end = fix.End().Offset
+		severity = severityWarning
+	}
+	return diagnostic{
+		Range:    lspRange{Start: doc.position(start), End: doc.position(end)},
+		Severity: severity,
+		Code:     reflect.TypeOf(issue).Name(),
+		Source:   "gofmts",
+		Message:  issue.Details(),
+	}
+}
+
+// issueEdit returns the edit that fixes an issue
+func issueEdit(doc *document, fix gofmts.IssueWithReplacement) textEdit {
+	return textEdit{
+		Range:   lspRange{Start: doc.position(fix.Position().Offset), End: doc.position(fix.End().Offset)},
+		NewText: fix.Replacement(),
+	}
+}
+
+// uriFilename returns the name of the file that a "file:" uri refers to
+func uriFilename(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	path := u.Path
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:] // windows drive letter, as in file:///c:/dir/file.go
+	}
+	return filepath.FromSlash(path)
+}
+
+// document converts between byte offsets and the line and UTF-16 character positions used by the protocol
+type document struct {
+	text       string
+	lineStarts []int
+}
+
+func newDocument(text string) *document {
+	d := &document{text: text, lineStarts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	return d
+}
+
+func (d *document) position(offset int) position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	line := 0
+	for line+1 < len(d.lineStarts) && d.lineStarts[line+1] <= offset {
+		line++
+	}
+	character := 0
+	for _, r := range d.text[d.lineStarts[line]:offset] {
+		if r >= 0x10000 {
+			character += 2 // encoded as a surrogate pair
+		} else {
+			character++
+		}
+	}
+	return position{Line: line, Character: character}
+}
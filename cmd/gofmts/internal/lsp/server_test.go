@@ -0,0 +1,243 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ashanbrown/gofmts/pkg/gofmts"
+)
+
+// client drives a server over in-process pipes
+type client struct {
+	t      *testing.T
+	conn   *conn
+	nextID int
+	done   chan error
+}
+
+func newClient(t *testing.T, s *Server) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, conn: newConn(clientIn, clientOut), done: make(chan error, 1)}
+	go func() {
+		err := s.Serve(serverIn, serverOut)
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+// call sends a request and decodes the result of its response into "result"
+func (c *client) call(method string, params interface{}, result interface{}) error {
+	c.nextID++
+	id := json.RawMessage(strings.Repeat("1", c.nextID))
+	require.NoError(c.t, c.conn.write(map[string]interface{}{"jsonrpc": "2.0", "id": &id, "method": method, "params": params}))
+	msg := c.receive()
+	require.NotNil(c.t, msg.ID, "expected a response to %s", method)
+	assert.Equal(c.t, string(id), string(*msg.ID))
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if result != nil {
+		require.NoError(c.t, json.Unmarshal(msg.Result, result))
+	}
+	return nil
+}
+
+func (c *client) notify(method string, params interface{}) {
+	require.NoError(c.t, c.conn.notify(method, params))
+}
+
+func (c *client) receive() *message {
+	msg, err := c.conn.read()
+	require.NoError(c.t, err)
+	return msg
+}
+
+func (c *client) diagnostics() publishDiagnosticsParams {
+	msg := c.receive()
+	require.Equal(c.t, "textDocument/publishDiagnostics", msg.Method)
+	var p publishDiagnosticsParams
+	require.NoError(c.t, json.Unmarshal(msg.Params, &p))
+	return p
+}
+
+func TestServer(t *testing.T) {
+	const uri = "file:///src/p.go"
+	const formatted = "package p\n\n//gofmts:json\nconst a = `\n\t\t[1, 2]\n\t\t`\n"
+	const unformatted = "package p\n\n//gofmts:json\nconst a = `[1,2]`\n\nconst (\n\t//gofmts:sort\n\tz = 1\n\ty = 2\n)\n"
+
+	s := &Server{
+		Config: func(filename string) (*gofmts.Config, error) {
+			assert.Equal(t, "/src/p.go", filename)
+			return nil, nil
+		},
+	}
+	c := newClient(t, s)
+
+	var initResult initializeResult
+	require.NoError(t, c.call("initialize", map[string]interface{}{}, &initResult))
+	assert.Equal(t, serverCapabilities{
+		TextDocumentSync:           textDocumentSyncFull,
+		CodeActionProvider:         true,
+		DocumentFormattingProvider: true,
+	}, initResult.Capabilities)
+	c.notify("initialized", map[string]interface{}{})
+
+	t.Run("diagnostics are published when a document is opened", func(t *testing.T) {
+		c.notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: uri, Text: unformatted}})
+		p := c.diagnostics()
+		assert.Equal(t, uri, p.URI)
+		require.Len(t, p.Diagnostics, 2)
+		assert.Equal(t, diagnostic{
+			Range:    lspRange{Start: position{Line: 3, Character: 10}, End: position{Line: 3, Character: 17}},
+			Severity: severityWarning,
+			Code:     "FormatIssue",
+			Source:   "gofmts",
+			Message:  "json formatting differs",
+		}, p.Diagnostics[0])
+		assert.Equal(t, "SortIssue", p.Diagnostics[1].Code)
+	})
+
+	t.Run("code actions fix issues in the requested range", func(t *testing.T) {
+		var actions []codeAction
+		require.NoError(t, c.call("textDocument/codeAction", codeActionParams{
+			TextDocument: textDocumentIdentifier{URI: uri},
+			Range:        lspRange{Start: position{Line: 3, Character: 12}, End: position{Line: 3, Character: 12}},
+		}, &actions))
+		require.Len(t, actions, 1)
+		assert.Equal(t, "quickfix", actions[0].Kind)
+		assert.Equal(t, []textEdit{{
+			Range:   lspRange{Start: position{Line: 3, Character: 10}, End: position{Line: 3, Character: 17}},
+			NewText: "`\n\t\t[1, 2]\n\t\t`",
+		}}, actions[0].Edit.Changes[uri])
+
+		require.NoError(t, c.call("textDocument/codeAction", codeActionParams{
+			TextDocument: textDocumentIdentifier{URI: uri},
+			Range:        lspRange{Start: position{Line: 7, Character: 0}, End: position{Line: 8, Character: 0}},
+		}, &actions))
+		require.Len(t, actions, 1)
+		assert.Equal(t, []textEdit{{
+			Range:   lspRange{Start: position{Line: 7, Character: 0}, End: position{Line: 9, Character: 0}},
+			NewText: "\ty = 2\n\tz = 1\n",
+		}}, actions[0].Edit.Changes[uri])
+	})
+
+	t.Run("sort code actions apply cleanly after lines that gofmt removes", func(t *testing.T) {
+		const spaced = "package p\n\n\n\nconst (\n\t//gofmts:sort\n\tz = 1\n\ty = 2\n)\n"
+		c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []map[string]string{{"text": spaced}},
+		})
+		require.Len(t, c.diagnostics().Diagnostics, 1)
+
+		var actions []codeAction
+		require.NoError(t, c.call("textDocument/codeAction", codeActionParams{
+			TextDocument: textDocumentIdentifier{URI: uri},
+			Range:        lspRange{Start: position{Line: 6, Character: 0}, End: position{Line: 6, Character: 0}},
+		}, &actions))
+		require.Len(t, actions, 1)
+		edits := actions[0].Edit.Changes[uri]
+		require.Len(t, edits, 1)
+		assert.Equal(t, "package p\n\n\n\nconst (\n\t//gofmts:sort\n\ty = 2\n\tz = 1\n)\n", applyEdit(spaced, edits[0]))
+	})
+
+	t.Run("changes are diagnosed again", func(t *testing.T) {
+		c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 3},
+			"contentChanges": []map[string]string{{"text": formatted}},
+		})
+		p := c.diagnostics()
+		assert.Empty(t, p.Diagnostics)
+	})
+
+	t.Run("formatting leaves a formatted document alone", func(t *testing.T) {
+		var edits []textEdit
+		require.NoError(t, c.call("textDocument/formatting",
+			documentFormattingParams{TextDocument: textDocumentIdentifier{URI: uri}}, &edits))
+		assert.Empty(t, edits)
+	})
+
+	t.Run("formatting makes the fixes that it can and leaves the rest as diagnostics", func(t *testing.T) {
+		c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 4},
+			"contentChanges": []map[string]string{{"text": unformatted + "\n//gofmts:graphql\nconst q = `{a}`\n"}},
+		})
+		p := c.diagnostics()
+		require.Len(t, p.Diagnostics, 3)
+		var codes []string
+		for _, d := range p.Diagnostics {
+			codes = append(codes, d.Code)
+		}
+		assert.ElementsMatch(t, []string{"FormatIssue", "SortIssue", "UnknownDirective"}, codes)
+
+		var edits []textEdit
+		require.NoError(t, c.call("textDocument/formatting",
+			documentFormattingParams{TextDocument: textDocumentIdentifier{URI: uri}}, &edits))
+		require.Len(t, edits, 1)
+		assert.Equal(t, lspRange{End: position{Line: 13, Character: 0}}, edits[0].Range)
+		assert.Equal(t, "package p\n\n//gofmts:json\nconst a = `\n\t\t[1, 2]\n\t\t`\n\nconst (\n\t//gofmts:sort\n\ty = 2\n\tz = 1\n)\n"+
+			"\n//gofmts:graphql\nconst q = `{a}`\n", edits[0].NewText)
+	})
+
+	t.Run("unknown methods are rejected", func(t *testing.T) {
+		err := c.call("workspace/symbol", map[string]interface{}{}, nil)
+		require.Error(t, err)
+		assert.Equal(t, codeMethodNotFound, err.(*responseError).Code)
+	})
+
+	t.Run("closing a document clears its diagnostics", func(t *testing.T) {
+		c.notify("textDocument/didClose", didCloseParams{TextDocument: textDocumentIdentifier{URI: uri}})
+		assert.Empty(t, c.diagnostics().Diagnostics)
+	})
+
+	require.NoError(t, c.call("shutdown", nil, nil))
+	c.notify("exit", nil)
+	assert.NoError(t, <-c.done)
+}
+
+// applyEdit makes an edit to a text that holds only ASCII, so that characters are bytes
+func applyEdit(text string, edit textEdit) string {
+	doc := newDocument(text)
+	offset := func(p position) int { return doc.lineStarts[p.Line] + p.Character }
+	return text[:offset(edit.Range.Start)] + edit.NewText + text[offset(edit.Range.End):]
+}
+
+func TestDocumentPosition(t *testing.T) {
+	doc := newDocument("a😀b\nc")
+	assert.Equal(t, position{Line: 0, Character: 3}, doc.position(5))
+	assert.Equal(t, position{Line: 1, Character: 0}, doc.position(7))
+	assert.Equal(t, position{Line: 1, Character: 1}, doc.position(8))
+}
+
+func TestServerExcludes(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, gofmts.ConfigFileName)
+	require.NoError(t, ioutil.WriteFile(configFile, []byte("exclude: [\"*_gen.go\"]\n"), 0600))
+	cfg, err := gofmts.LoadConfig(configFile)
+	require.NoError(t, err)
+	c := newClient(t, &Server{Config: func(string) (*gofmts.Config, error) { return cfg, nil }})
+	require.NoError(t, c.call("initialize", map[string]interface{}{}, nil))
+
+	uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(dir, "p_gen.go"))}).String()
+	c.notify("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: uri,
+		Text: "package p\n\n//gofmts:json\nconst a = `[1,2]`\n"}})
+	assert.Empty(t, c.diagnostics().Diagnostics)
+
+	var edits []textEdit
+	require.NoError(t, c.call("textDocument/formatting",
+		documentFormattingParams{TextDocument: textDocumentIdentifier{URI: uri}}, &edits))
+	assert.Empty(t, edits)
+
+	require.NoError(t, c.call("shutdown", nil, nil))
+	c.notify("exit", nil)
+	assert.NoError(t, <-c.done)
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ashanbrown/gofmts/pkg/gofmts"
+)
+
+const textFormat = "text"
+
+var outputFormat = flag.String("format", textFormat, "write issues as text, json, sarif, checkstyle or github workflow commands")
+
+// issueWriters write the issues found in all files in a machine-readable format
+var issueWriters = map[string]func(w io.Writer, issues []gofmts.Issue) error{
+	"checkstyle": writeCheckstyle,
+	"github":     writeGithub,
+	"json":       writeJSON,
+	"sarif":      writeSarif,
+}
+
+var reportedIssues []gofmts.Issue // issues from all files, in the order in which the files were given
+
+func initOutputFormat() error {
+	if *outputFormat == textFormat {
+		return nil
+	}
+	if _, ok := issueWriters[*outputFormat]; !ok {
+		return errors.Errorf("unknown format %q", *outputFormat)
+	}
+	if *list || *doDiff {
+		return errors.Errorf("cannot use -l or -d with -format=%s", *outputFormat)
+	}
+	return nil
+}
+
+func writeIssues(w io.Writer, issues []gofmts.Issue) error {
+	if *outputFormat == textFormat {
+		return nil
+	}
+	return issueWriters[*outputFormat](w, issues)
+}
+
+type issueRecord struct {
+	Kind        string        `json:"kind"`
+	Directive   string        `json:"directive"`
+	Message     string        `json:"message"`
+	File        string        `json:"file"`
+	Start       issuePosition `json:"start"`
+	End         issuePosition `json:"end"`
+	Replacement *string       `json:"replacement,omitempty"`
+}
+
+type issuePosition struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func newIssueRecord(issue gofmts.Issue) issueRecord {
+	start := issue.Position()
+	end := start
+	var replacement *string
+	if fix, ok := issue.(gofmts.IssueWithReplacement); ok {
+		end = fix.End()
+		r := fix.Replacement()
+		replacement = &r
+	}
+	var directive string
+	if d, ok := issue.(gofmts.IssueWithDirective); ok {
+		directive = d.Directive()
+	}
+	return issueRecord{
+		Kind:        issueKind(issue),
+		Directive:   directive,
+		Message:     issue.Details(),
+		File:        filepath.ToSlash(start.Filename),
+		Start:       issuePosition{Offset: start.Offset, Line: start.Line, Column: start.Column},
+		End:         issuePosition{Offset: end.Offset, Line: end.Line, Column: end.Column},
+		Replacement: replacement,
+	}
+}
+
+// issueKind names the type of an issue, such as FormatIssue or UnknownDirective
+func issueKind(issue gofmts.Issue) string {
+	return reflect.TypeOf(issue).Name()
+}
+
+// issueLevel is "warning" for issues that gofmts can fix and "error" for those it can't
+func issueLevel(issue gofmts.Issue) string {
+	if _, ok := issue.(gofmts.IssueWithReplacement); ok {
+		return "warning"
+	}
+	return "error"
+}
+
+func writeJSON(w io.Writer, issues []gofmts.Issue) error {
+	records := make([]issueRecord, 0, len(issues))
+	for _, issue := range issues {
+		records = append(records, newIssueRecord(issue))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// sarif types follow the Static Analysis Results Interchange Format, version 2.1.0
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+	CharOffset  int `json:"charOffset,omitempty"`
+	CharLength  int `json:"charLength,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+func writeSarif(w io.Writer, issues []gofmts.Issue) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "gofmts",
+			InformationURI: "https://github.com/ashanbrown/gofmts",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	seenRules := make(map[string]bool)
+	for _, issue := range issues {
+		r := newIssueRecord(issue)
+		if !seenRules[r.Kind] {
+			seenRules[r.Kind] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: r.Kind})
+		}
+		location := sarifArtifactLocation{URI: r.File}
+		result := sarifResult{
+			RuleID:  r.Kind,
+			Level:   issueLevel(issue),
+			Message: sarifMessage{Text: r.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: location,
+				Region: sarifRegion{
+					StartLine:   r.Start.Line,
+					StartColumn: r.Start.Column,
+					EndLine:     r.End.Line,
+					EndColumn:   r.End.Column,
+				},
+			}}},
+		}
+		if r.Replacement != nil {
+			result.Fixes = []sarifFix{{
+				Description: sarifMessage{Text: r.Message},
+				ArtifactChanges: []sarifArtifactChange{{
+					ArtifactLocation: location,
+					Replacements: []sarifReplacement{{
+						DeletedRegion:   sarifRegion{CharOffset: r.Start.Offset, CharLength: r.End.Offset - r.Start.Offset},
+						InsertedContent: sarifMessage{Text: *r.Replacement},
+					}},
+				}},
+			}}
+		}
+		run.Results = append(run.Results, result)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	})
+}
+
+type checkstyleOutput struct {
+	XMLName xml.Name          `xml:"checkstyle"`
+	Version string            `xml:"version,attr"`
+	Files   []*checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+func writeCheckstyle(w io.Writer, issues []gofmts.Issue) error {
+	out := checkstyleOutput{Version: "5.0"}
+	files := make(map[string]*checkstyleFile)
+	for _, issue := range issues {
+		r := newIssueRecord(issue)
+		file := files[r.File]
+		if file == nil {
+			file = &checkstyleFile{Name: r.File}
+			files[r.File] = file
+			out.Files = append(out.Files, file)
+		}
+		file.Errors = append(file.Errors, checkstyleError{
+			Line:     r.Start.Line,
+			Column:   r.Start.Column,
+			Severity: issueLevel(issue),
+			Message:  r.Message,
+			Source:   "gofmts." + r.Kind,
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeGithub writes workflow commands that annotate the issues in GitHub Actions
+func writeGithub(w io.Writer, issues []gofmts.Issue) error {
+	for _, issue := range issues {
+		r := newIssueRecord(issue)
+		_, err := fmt.Fprintf(w, "::%s file=%s,line=%d,col=%d,endLine=%d,endColumn=%d,title=%s::%s\n",
+			issueLevel(issue), githubProperty(r.File), r.Start.Line, r.Start.Column, r.End.Line, r.End.Column,
+			githubProperty("gofmts "+r.Kind), githubData(r.Message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	githubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func githubData(s string) string {
+	return githubDataEscaper.Replace(s)
+}
+
+func githubProperty(s string) string {
+	return githubPropertyEscaper.Replace(s)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ashanbrown/gofmts/pkg/gofmts"
+)
+
+func TestWriteIssues(t *testing.T) {
+	src := []byte("package p\n\n//gofmts:json\nconst a = `[1,2]`\n\n//gofmts:nope\nconst b = `x`\n")
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "a/p.go", src, parser.ParseComments)
+	require.NoError(t, err)
+	issues, err := gofmts.NewFormatter().Run(src, fset, file)
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeJSON(&buf, issues))
+		var records []issueRecord
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &records))
+		require.Len(t, records, 2)
+		assert.Equal(t, "FormatIssue", records[0].Kind)
+		assert.Equal(t, "json", records[0].Directive)
+		assert.Equal(t, "a/p.go", records[0].File)
+		assert.Equal(t, issuePosition{Offset: 35, Line: 4, Column: 11}, records[0].Start)
+		assert.Equal(t, issuePosition{Offset: 42, Line: 4, Column: 18}, records[0].End)
+		require.NotNil(t, records[0].Replacement)
+		assert.Equal(t, "`\n\t\t[1, 2]\n\t\t`", *records[0].Replacement)
+		assert.Equal(t, "UnknownDirective", records[1].Kind)
+		assert.Equal(t, "nope", records[1].Directive)
+		assert.Nil(t, records[1].Replacement)
+	})
+
+	t.Run("issues from elsewhere need not name a directive", func(t *testing.T) {
+		r := newIssueRecord(plainIssue{issues[1]})
+		assert.Equal(t, "plainIssue", r.Kind)
+		assert.Empty(t, r.Directive)
+	})
+
+	t.Run("github", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeGithub(&buf, issues))
+		assert.Equal(t, "::warning file=a/p.go,line=4,col=11,endLine=4,endColumn=18,title=gofmts FormatIssue::"+
+			"json formatting differs\n"+
+			"::error file=a/p.go,line=6,col=14,endLine=6,endColumn=14,title=gofmts UnknownDirective::"+
+			"unknown directive `gofmts:nope`\n", buf.String())
+	})
+
+	t.Run("checkstyle", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeCheckstyle(&buf, issues))
+		assert.Contains(t, buf.String(), `<file name="a/p.go">`)
+		assert.Contains(t, buf.String(),
+			`<error line="4" column="11" severity="warning" message="json formatting differs" source="gofmts.FormatIssue">`)
+	})
+
+	t.Run("sarif", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, writeSarif(&buf, issues))
+		var log sarifLog
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+		require.Len(t, log.Runs, 1)
+		assert.Equal(t, []sarifRule{{ID: "FormatIssue"}, {ID: "UnknownDirective"}}, log.Runs[0].Tool.Driver.Rules)
+		require.Len(t, log.Runs[0].Results, 2)
+		require.Len(t, log.Runs[0].Results[0].Fixes, 1)
+		assert.Equal(t, sarifRegion{CharOffset: 35, CharLength: 7},
+			log.Runs[0].Results[0].Fixes[0].ArtifactChanges[0].Replacements[0].DeletedRegion)
+		assert.Empty(t, log.Runs[0].Results[1].Fixes)
+	})
+}
+
+// plainIssue hides all but the methods of gofmts.Issue
+type plainIssue struct {
+	gofmts.Issue
+}
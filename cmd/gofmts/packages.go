@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	buildTags        = flag.String("tags", "", "comma-separated list of build tags to consider satisfied when selecting files")
+	includeGenerated = flag.Bool("generated", false, "also format generated files in directories and packages")
+)
+
+// buildContext decides which files in a directory are part of its package
+var buildContext = build.Default
+
+func initBuildContext() {
+	buildContext.BuildTags = strings.FieldsFunc(*buildTags, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// packageFiles returns the go files of the packages matching "pattern".  Like the go command, "..." in a pattern
+// matches any string, including the empty string, and a pattern may be a directory or an import path.  A directory on
+// its own matches all the packages beneath it.  Files excluded by the build context and directories named vendor or
+// testdata, or starting with "." or "_", are skipped.
+func packageFiles(pattern string) ([]string, error) {
+	prefix := pattern
+	if i := strings.Index(pattern, "..."); i >= 0 {
+		prefix = pattern[:i]
+		if j := strings.LastIndex(prefix, "/"); j >= 0 {
+			prefix = prefix[:j]
+		} else {
+			prefix = ""
+		}
+	}
+	root, isImportPath, err := patternDir(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == pattern {
+		if isImportPath {
+			return dirFiles(root)
+		}
+		pattern = path.Join(pattern, "...")
+	}
+	match := matchPattern(path.Clean(pattern))
+
+	var files []string
+	err = filepath.Walk(root, func(p string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !f.IsDir() {
+			return nil
+		}
+		if p != root && skipDir(f.Name()) {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if !match(path.Join(prefix, filepath.ToSlash(rel))) {
+			return nil
+		}
+		found, err := dirFiles(p)
+		files = append(files, found...)
+		return err
+	})
+	return files, err
+}
+
+// patternDir finds the directory named by the literal part of a pattern, which may be an import path
+func patternDir(prefix string) (dir string, isImportPath bool, _ error) {
+	if prefix == "" {
+		return ".", false, nil
+	}
+	fi, err := os.Stat(prefix)
+	if err == nil {
+		if !fi.IsDir() {
+			return "", false, errors.Errorf("%s is not a directory", prefix)
+		}
+		return prefix, false, nil
+	}
+	if build.IsLocalImport(prefix) || filepath.IsAbs(prefix) {
+		return "", false, err
+	}
+	pkg, importErr := buildContext.Import(prefix, ".", build.FindOnly)
+	if importErr != nil {
+		return "", false, err // report that the path doesn't exist rather than why it isn't a package
+	}
+	return pkg.Dir, true, nil
+}
+
+// dirFiles returns the go files in "dir" that are part of the build
+func dirFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, fi := range infos {
+		if !isGoFile(fi) {
+			continue
+		}
+		if ok, err := buildContext.MatchFile(dir, fi.Name()); err != nil {
+			return nil, err
+		} else if ok {
+			files = append(files, filepath.Join(dir, fi.Name()))
+		}
+	}
+	return files, nil
+}
+
+func skipDir(name string) bool {
+	return name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// matchPattern returns a function reporting whether a package path matches "pattern", in which "..." matches any
+// string, and "x/..." also matches "x" itself
+func matchPattern(pattern string) func(name string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\.\.\.`, `.*`, -1)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	reg := regexp.MustCompile(`^` + re + `$`)
+	return reg.MatchString
+}
+
+// generatedPattern matches the comment marking generated files (see https://golang.org/s/generatedcode)
+var generatedPattern = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the source of a go file is marked as generated before its package clause
+func isGenerated(src []byte) bool {
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if bytes.HasPrefix(line, []byte("package ")) {
+			break
+		}
+		if generatedPattern.Match(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofmts-packages")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, contents := range map[string]string{
+		"a.go":                 "package a\n",
+		"tagged.go":            "//go:build special\n// +build special\n\npackage a\n",
+		"b/b.go":               "package b\n",
+		"b/c/c.go":             "package c\n",
+		"vendor/v/v.go":        "package v\n",
+		"testdata/t.go":        "package t\n",
+		"_ignored/i.go":        "package i\n",
+		"b/notes.txt":          "not go\n",
+		"b/c/other_windows.go": "package c\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd) // nolint:errcheck
+
+	defer func(ctxt build.Context) { buildContext = ctxt }(buildContext)
+	buildContext.GOOS = "linux"
+
+	t.Run("all packages", func(t *testing.T) {
+		files, err := packageFiles("./...")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.go", "b/b.go", "b/c/c.go"}, toSlash(files))
+	})
+
+	t.Run("directories include the packages beneath them", func(t *testing.T) {
+		files, err := packageFiles("b")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b/b.go", "b/c/c.go"}, toSlash(files))
+	})
+
+	t.Run("wildcards within a path", func(t *testing.T) {
+		files, err := packageFiles("./b/c...")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b/c/c.go"}, toSlash(files))
+	})
+
+	t.Run("build tags", func(t *testing.T) {
+		buildContext.BuildTags = []string{"special"}
+		defer func() { buildContext.BuildTags = nil }()
+		files, err := packageFiles(".")
+		require.NoError(t, err)
+		assert.Contains(t, toSlash(files), "tagged.go")
+	})
+
+	t.Run("missing directories", func(t *testing.T) {
+		_, err := packageFiles("./missing/...")
+		assert.Error(t, err)
+	})
+}
+
+func TestIsGenerated(t *testing.T) {
+	assert.True(t, isGenerated([]byte("// Code generated by stringer; DO NOT EDIT.\n\npackage a\n")))
+	assert.False(t, isGenerated([]byte("package a\n\n// Code generated by stringer; DO NOT EDIT.\n")))
+	assert.False(t, isGenerated([]byte("// Code generated by hand, please edit.\npackage a\n")))
+}
+
+func toSlash(files []string) []string {
+	var slashed []string
+	for _, f := range files {
+		slashed = append(slashed, filepath.ToSlash(f))
+	}
+	return slashed
+}
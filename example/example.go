@@ -31,3 +31,8 @@ const (
 
 //gofmts:go
 const expr = "1 +  2"
+
+//gofmts:yaml
+const Yaml = `
+kind:   Pod
+metadata: {name: example}`
@@ -13,4 +13,5 @@ require (
 	golang.org/x/net v0.0.0-20220127200216-cd36cc0744dd // indirect
 	golang.org/x/sys v0.0.0-20220209214540-3681064d5158 // indirect
 	golang.org/x/tools v0.1.9
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -1,7 +1,9 @@
 package analyzer
 
 import (
+	"go/ast"
 	"go/token"
+	"io/ioutil"
 
 	"github.com/ashanbrown/gofmts/pkg/gofmts"
 	"github.com/pkg/errors"
@@ -15,13 +17,23 @@ var SortAnalyzer = &analysis.Analyzer{
 }
 
 func runSortAnalysis(pass *analysis.Pass) (interface{}, error) {
-	srtr := gofmts.NewSorter()
-	issues, err := srtr.Run(pass.Fset, pass.Files...)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to analyze file for sort")
+	for _, file := range pass.Files {
+		filename := fileName(pass, file)
+		cfg, err := loadConfig(filename)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Excludes(filename) {
+			continue
+		}
+		srtr := gofmts.NewSorter()
+		srtr.Configure(cfg)
+		issues, err := srtr.Run(pass.Fset, file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to analyze file for sort")
+		}
+		reportIssues(pass, issues, "sort?")
 	}
-
-	reportIssues(pass, issues, "sort?")
 	return nil, nil
 }
 
@@ -31,10 +43,52 @@ var FormatAnalyzer = &analysis.Analyzer{
 	Run:  runFormatAnalysis,
 }
 
+var configFile string
+
+func init() {
+	FormatAnalyzer.Flags.StringVar(&configFile, "config", "", "read configuration from this file")
+	SortAnalyzer.Flags.StringVar(&configFile, "config", "", "read configuration from this file")
+}
+
+// loadConfig returns the configuration given by the "config" flag or, if there is none, the one found by searching up
+// the directory tree from "filename"
+func loadConfig(filename string) (*gofmts.Config, error) {
+	if configFile != "" {
+		return gofmts.LoadConfig(configFile)
+	}
+	return gofmts.FindConfig(filename)
+}
+
+func fileName(pass *analysis.Pass, file *ast.File) string {
+	return pass.Fset.File(file.Pos()).Name()
+}
+
+// readSource returns the contents of a file so that strings are indented to the same tab stops as the command does,
+// or nil if the file on disk doesn't match the one that was parsed
+func readSource(pass *analysis.Pass, file *ast.File) []byte {
+	tokenFile := pass.Fset.File(file.Pos())
+	src, err := ioutil.ReadFile(tokenFile.Name())
+	if err != nil || len(src) != tokenFile.Size() {
+		return nil
+	}
+	return src
+}
+
 func runFormatAnalysis(pass *analysis.Pass) (interface{}, error) {
-	fmtr := gofmts.NewFormatter()
 	for _, file := range pass.Files {
-		issues, err := fmtr.Run(nil /* this means we can't guess what the tab stop is */, pass.Fset, file)
+		filename := fileName(pass, file)
+		cfg, err := loadConfig(filename)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Excludes(filename) {
+			continue
+		}
+		fmtr := gofmts.NewFormatter()
+		if err := fmtr.Configure(cfg); err != nil {
+			return nil, err
+		}
+		issues, err := fmtr.Run(readSource(pass, file), pass.Fset, file)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to format file")
 		}
@@ -52,7 +106,7 @@ func reportIssues(pass *analysis.Pass, issues []gofmts.Issue, prompt string) {
 			Category: "format",
 		}
 		if ii, ok := i.(gofmts.IssueWithReplacement); ok {
-			diag.End = diag.Pos + token.Pos(ii.Length()) + 1
+			diag.End = diag.Pos + token.Pos(ii.Length())
 			diag.SuggestedFixes = []analysis.SuggestedFix{{
 				Message: prompt,
 				TextEdits: []analysis.TextEdit{{
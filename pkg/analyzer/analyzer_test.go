@@ -16,3 +16,8 @@ func TestFormatAnalyzer(t *testing.T) {
 	testdata := analysistest.TestData()
 	analysistest.RunWithSuggestedFixes(t, testdata, analyzer.FormatAnalyzer, "./format")
 }
+
+func TestFormatAnalyzerWithConfig(t *testing.T) {
+	testdata := analysistest.TestData()
+	analysistest.RunWithSuggestedFixes(t, testdata, analyzer.FormatAnalyzer, "./config/...")
+}
@@ -0,0 +1,4 @@
+package config
+
+//gofmts:pgsql
+const Sql = /* want "pgsql formatting differs" */ `SELECT * FROM mytable`
@@ -0,0 +1,4 @@
+package excluded
+
+//gofmts:sql
+const Sql = `SELECT * FROM mytable`
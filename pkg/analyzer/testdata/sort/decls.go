@@ -0,0 +1,6 @@
+package sort
+
+//gofmts:sort decls
+func b() {} // want "block is unsorted"
+
+func a() {}
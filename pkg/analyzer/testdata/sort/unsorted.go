@@ -17,3 +17,16 @@ const (
 	// move this
 	A3 = 2
 )
+
+const (
+	//gofmts:sort natural reverse
+	Item2  = 2 // want "block is unsorted"
+	Item10 = 10
+)
+
+var allowed = []string{
+	//gofmts:sort unique
+	"a",
+	"a", // want `duplicate entry "a" \(first on line 29\)`
+	"b",
+}
@@ -0,0 +1,35 @@
+package gofmts
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CommandFormatter formats strings by piping them through an external command.  The string is written to the
+// command's standard input and the formatted result is read from its standard output.
+type CommandFormatter struct {
+	Args []string
+}
+
+func (f CommandFormatter) Format(value string, _ DirectiveOptions) (string, error) {
+	if len(f.Args) == 0 {
+		return "", errors.New("no command configured")
+	}
+	cmd := exec.Command(f.Args[0], f.Args[1:]...) // nolint:gosec // running the configured command is the point
+	cmd.Stdin = strings.NewReader(value)
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.Wrapf(err, "command `%s` failed: %s", strings.Join(f.Args, " "), msg)
+		}
+		return "", errors.Wrapf(err, "command `%s` failed", strings.Join(f.Args, " "))
+	}
+	// commands usually terminate their output with a newline, which would make every string multiline
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
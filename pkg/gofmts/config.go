@@ -0,0 +1,207 @@
+package gofmts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the name of the configuration file that is discovered by FindConfig
+const ConfigFileName = ".gofmts.yaml"
+
+// Config holds the settings read from a gofmts configuration file, such as:
+//
+//	commands:
+//	  graphql: prettier --parser graphql
+//	  pgsql: [pg_format, --keyword-case, "2"]
+//	options:
+//	  json:
+//	    indent: 4
+//	  sql:
+//	    case: lower
+//	aliases:
+//	  psql: sql
+//	disabled: [go]
+//	exclude: [vendor, "*_gen.go"]
+//	tab-width: 4
+type Config struct {
+	// Commands maps directive names to external commands used to format them
+	Commands map[string]Command `yaml:"commands"`
+	// Options sets the default options for each directive, which can be overridden on the directive itself
+	Options map[string]DirectiveOptions `yaml:"options"`
+	// Aliases maps additional directive names to existing directives
+	Aliases map[string]string `yaml:"aliases"`
+	// Disabled lists directives that are ignored
+	Disabled []string `yaml:"disabled"`
+	// Exclude lists patterns for paths, relative to the configuration file, that are not processed
+	Exclude []string `yaml:"exclude"`
+	// TabWidth is the width of a tab used to position formatted strings
+	TabWidth int `yaml:"tab-width"`
+
+	dir        string
+	discovered bool // found by FindConfig rather than given explicitly, so its commands aren't trusted to run
+}
+
+// Command is an external command and its arguments.  It may be written in the configuration file either as a list or
+// as a single string that is split on whitespace.
+type Command []string
+
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = strings.Fields(node.Value)
+		return nil
+	}
+	var args []string
+	if err := node.Decode(&args); err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// LoadConfig reads the configuration file at "path"
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read config")
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse config %s", path)
+	}
+	for name, cmd := range cfg.Commands {
+		if len(cmd) == 0 {
+			return nil, errors.Errorf("unable to parse config %s: command for %q is empty", path, name)
+		}
+	}
+	if cfg.TabWidth < 0 {
+		return nil, errors.Errorf("unable to parse config %s: tab-width must be positive", path)
+	}
+	cfg.dir, err = filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// FindConfig looks for a configuration file in the directory containing "path" (or "path" itself if it is a
+// directory) and each of its parents, returning the first one found or nil if there is none.  The file may come from
+// a checkout that isn't trusted, so the commands it lists are never run; they must be given with LoadConfig instead.
+func FindConfig(path string) (*Config, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		candidate := filepath.Join(dir, ConfigFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			cfg, err := LoadConfig(candidate)
+			if err != nil {
+				return nil, err
+			}
+			cfg.discovered = true
+			return cfg, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Excludes reports whether "path" matches one of the exclude patterns.  A pattern matches a path relative to the
+// directory of the configuration file, any directory that contains it or, if the pattern has no slashes, its base name.
+func (c *Config) Excludes(path string) bool {
+	if c == nil || len(c.Exclude) == 0 {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(c.dir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range c.Exclude {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := filepath.Match(pattern, filepath.Base(abs)); matched {
+				return true
+			}
+		}
+		for prefix := rel; prefix != "."; prefix = filepath.ToSlash(filepath.Dir(prefix)) {
+			if matched, _ := filepath.Match(pattern, prefix); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Configure applies the settings in "cfg" to the formatter.  The commands of a configuration found by FindConfig are
+// ignored, along with the aliases for them.
+func (f *Formatter) Configure(cfg *Config) error {
+	if cfg == nil {
+		return nil
+	}
+	if !cfg.discovered {
+		for name, cmd := range cfg.Commands {
+			f.Register(name, CommandFormatter{Args: cmd})
+		}
+	}
+	for alias, name := range cfg.Aliases {
+		if _, ok := cfg.Commands[name]; ok && cfg.discovered {
+			continue // the command isn't registered
+		}
+		if _, ok := f.registry.Lookup(name); !ok {
+			return errors.Errorf("alias %q refers to unknown directive %q", alias, name)
+		}
+		f.aliases[alias] = name
+	}
+	for name, opts := range cfg.Options {
+		if _, ok := f.registry.Lookup(f.resolveAlias(name)); !ok {
+			return errors.Errorf("options given for unknown directive %q", name)
+		}
+		var unknown []string
+		for option := range opts {
+			if !f.registry.acceptsOption(f.resolveAlias(name), option) {
+				unknown = append(unknown, option)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return errors.Errorf("unknown options for directive %q: %s", name, strings.Join(unknown, ", "))
+		}
+		f.defaultOptions[f.resolveAlias(name)] = opts
+	}
+	for _, name := range cfg.Disabled {
+		f.disabled[name] = true
+	}
+	if cfg.TabWidth > 0 {
+		f.tabWidth = cfg.TabWidth
+	}
+	return nil
+}
+
+// Configure applies the settings in "cfg" to the sorter
+func (s *Sorter) Configure(cfg *Config) {
+	if cfg == nil {
+		return
+	}
+	for _, name := range cfg.Disabled {
+		if name == "sort" {
+			s.disabled = true
+		}
+	}
+}
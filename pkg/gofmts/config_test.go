@@ -0,0 +1,242 @@
+package gofmts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperProcess isn't a real test.  It stands in for an external formatter command.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GOFMTS_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	input, _ := ioutil.ReadAll(os.Stdin)
+	switch os.Args[len(os.Args)-1] {
+	case "upper":
+		fmt.Println(strings.ToUpper(string(input)))
+		os.Exit(0)
+	default:
+		fmt.Fprintln(os.Stderr, "bad input")
+		os.Exit(1)
+	}
+}
+
+func helperCommand(mode string) string {
+	return fmt.Sprintf("[%q, -test.run=TestHelperProcess, --, %s]", os.Args[0], mode)
+}
+
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func TestConfig(t *testing.T) {
+	require.NoError(t, os.Setenv("GOFMTS_WANT_HELPER_PROCESS", "1"))
+	defer os.Unsetenv("GOFMTS_WANT_HELPER_PROCESS")
+
+	t.Run("commands can be written as strings or lists", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "commands:\n  graphql: prettier --parser graphql\n  pgsql: [pg_format]\n"))
+		require.NoError(t, err)
+		assert.Equal(t, Command{"prettier", "--parser", "graphql"}, cfg.Commands["graphql"])
+		assert.Equal(t, Command{"pg_format"}, cfg.Commands["pgsql"])
+	})
+
+	t.Run("empty commands are rejected", func(t *testing.T) {
+		_, err := LoadConfig(writeConfig(t, "commands:\n  graphql: ''\n"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `command for "graphql" is empty`)
+	})
+
+	t.Run("configured commands format strings", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "commands:\n  upper: "+helperCommand("upper")+"\n"))
+		require.NoError(t, err)
+		fmtr := NewFormatter()
+		require.NoError(t, fmtr.Configure(cfg))
+		issues, err := fmtr.Run(makeFormatterInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:upper
+				const value = "abc"
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "upper formatting differs", issues[0].Details())
+		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
+		assert.Equal(t, `"ABC"`, issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("failing commands report stderr", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "commands:\n  broken: "+helperCommand("fail")+"\n"))
+		require.NoError(t, err)
+		fmtr := NewFormatter()
+		require.NoError(t, fmtr.Configure(cfg))
+		issues, err := fmtr.Run(makeFormatterInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:broken
+				const value = "abc"
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.IsType(t, FailedDirective{}, issues[0])
+		assert.Contains(t, issues[0].Details(), "bad input: exit status 1")
+	})
+
+	t.Run("config is found in a parent directory", func(t *testing.T) {
+		root := t.TempDir()
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, ConfigFileName), []byte("disabled: [go]\n"), 0600))
+		nested := filepath.Join(root, "a", "b")
+		require.NoError(t, os.MkdirAll(nested, 0700))
+		cfg, err := FindConfig(filepath.Join(nested, "file.go"))
+		require.NoError(t, err)
+		require.NotNil(t, cfg)
+		assert.Equal(t, []string{"go"}, cfg.Disabled)
+	})
+
+	t.Run("commands are only run from a config that is given explicitly", func(t *testing.T) {
+		root := t.TempDir()
+		config := "commands:\n  upper: " + helperCommand("upper") + "\naliases:\n  up: upper\n"
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, ConfigFileName), []byte(config), 0600))
+		src := `package main
+
+				//gofmts:upper
+				const s = ` + "`abc`"
+
+		found, err := FindConfig(filepath.Join(root, "file.go"))
+		require.NoError(t, err)
+		fmtr := NewFormatter()
+		require.NoError(t, fmtr.Configure(found))
+		issues, err := fmtr.Run(makeFormatterInputs(t, src))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.IsType(t, UnknownDirective{}, issues[0])
+
+		given, err := LoadConfig(filepath.Join(root, ConfigFileName))
+		require.NoError(t, err)
+		fmtr = NewFormatter()
+		require.NoError(t, fmtr.Configure(given))
+		issues, err = fmtr.Run(makeFormatterInputs(t, src))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.IsType(t, FormatIssue{}, issues[0])
+	})
+
+	t.Run("paths are excluded relative to the config file", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "exclude: [vendor, \"*_gen.go\", pkg/legacy/*.go]\n"))
+		require.NoError(t, err)
+		assert.True(t, cfg.Excludes(filepath.Join(cfg.dir, "vendor", "x", "y.go")))
+		assert.True(t, cfg.Excludes(filepath.Join(cfg.dir, "pkg", "models_gen.go")))
+		assert.True(t, cfg.Excludes(filepath.Join(cfg.dir, "pkg", "legacy", "old.go")))
+		assert.False(t, cfg.Excludes(filepath.Join(cfg.dir, "pkg", "legacy", "sub", "old.go")))
+		assert.False(t, cfg.Excludes(filepath.Join(cfg.dir, "pkg", "main.go")))
+		assert.False(t, cfg.Excludes(filepath.Join(filepath.Dir(cfg.dir), "vendor", "y.go")))
+	})
+
+	t.Run("options, aliases and tab width are applied", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "options:\n  sql:\n    case: lower\naliases:\n  pgsql: sql\ntab-width: 4\n"))
+		require.NoError(t, err)
+		fmtr := NewFormatter()
+		require.NoError(t, fmtr.Configure(cfg))
+		issues, err := fmtr.Run(makeFormatterInputs(t,
+			`package main
+
+				//gofmts:pgsql
+				const sql = `+"`SELECT * FROM mytable`"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "pgsql formatting differs", issues[0].Details())
+		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
+		assert.Equal(t, "`\n\t\t\t\tselect\n\t\t\t\t  *\n\t\t\t\tfrom\n\t\t\t\t  mytable\n\t\t\t\t`",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("options on the directive override the config", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "options:\n  sql:\n    case: lower\n"))
+		require.NoError(t, err)
+		fmtr := NewFormatter()
+		require.NoError(t, fmtr.Configure(cfg))
+		issues, err := fmtr.Run(makeFormatterInputs(t,
+			`package main
+
+				//gofmts:sql case=upper
+				const sql = `+"`select * from mytable`"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Contains(t, issues[0].(IssueWithReplacement).Replacement(), "SELECT")
+	})
+
+	t.Run("disabled directives are ignored", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "disabled: [go, sort]\n"))
+		require.NoError(t, err)
+		fmtr := NewFormatter()
+		require.NoError(t, fmtr.Configure(cfg))
+		issues, err := fmtr.Run(makeFormatterInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:go
+				const expr = "1  + 2"
+				`))
+		require.NoError(t, err)
+		assert.Empty(t, issues)
+
+		srtr := NewSorter()
+		srtr.Configure(cfg)
+		_, fset, file := makeFormatterInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:sort
+				const Z = 1
+				const A = 2
+				`)
+		issues, err = srtr.Run(fset, file)
+		require.NoError(t, err)
+		assert.Empty(t, issues)
+	})
+
+	t.Run("disabled directives are ignored when used through an alias", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "aliases:\n  golang: go\ndisabled: [go]\n"))
+		require.NoError(t, err)
+		fmtr := NewFormatter()
+		require.NoError(t, fmtr.Configure(cfg))
+		issues, err := fmtr.Run(makeFormatterInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:golang
+				const expr = "1  + 2"
+				`))
+		require.NoError(t, err)
+		assert.Empty(t, issues)
+	})
+
+	t.Run("invalid settings are rejected", func(t *testing.T) {
+		cfg, err := LoadConfig(writeConfig(t, "options:\n  json:\n    spaces: 4\n"))
+		require.NoError(t, err)
+		err = NewFormatter().Configure(cfg)
+		require.Error(t, err)
+		assert.Equal(t, `unknown options for directive "json": spaces`, err.Error())
+
+		cfg, err = LoadConfig(writeConfig(t, "aliases:\n  gql: graphql\n"))
+		require.NoError(t, err)
+		err = NewFormatter().Configure(cfg)
+		require.Error(t, err)
+		assert.Equal(t, `alias "gql" refers to unknown directive "graphql"`, err.Error())
+	})
+}
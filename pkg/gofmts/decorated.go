@@ -0,0 +1,40 @@
+package gofmts
+
+import (
+	"go/ast"
+	"go/token"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/pkg/errors"
+)
+
+// decoratedFile is a file that is decorated once and shared by the formatter and the sorter.  Both make their changes
+// to the same tree, so that it only needs to be restored, and printed, once.
+type decoratedFile struct {
+	fset      *token.FileSet
+	ast       *ast.File
+	decorator *decorator.Decorator
+	dst       *dst.File
+}
+
+func decorateFile(fset *token.FileSet, file *ast.File) (*decoratedFile, error) {
+	dcrtr := decorator.NewDecorator(fset)
+	dstFile, err := dcrtr.DecorateFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decorate failed")
+	}
+	return &decoratedFile{fset: fset, ast: file, decorator: dcrtr, dst: dstFile}, nil
+}
+
+// restore returns a syntax tree with the changes made to the decorated file, along with the restorer, which holds the
+// FileSet that its positions refer to and the nodes restored from those of the decorated file
+func (d *decoratedFile) restore() (*decorator.Restorer, *ast.File, error) {
+	restorer := decorator.NewRestorer()
+	restorer.Fset = d.fset
+	file, err := restorer.RestoreFile(d.dst)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "dst restore failed")
+	}
+	return restorer, file, nil
+}
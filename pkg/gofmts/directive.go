@@ -0,0 +1,145 @@
+package gofmts
+
+import (
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// directive is a parsed `//gofmts:<name> [option[=value] ...]` comment
+type directive struct {
+	name    string
+	options DirectiveOptions
+}
+
+func parseDirective(name, args string) directive {
+	d := directive{name: name, options: make(DirectiveOptions)}
+	for _, arg := range strings.Fields(args) {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) == 1 {
+			d.options[parts[0]] = ""
+		} else {
+			d.options[parts[0]] = parts[1]
+		}
+	}
+	return d
+}
+
+// DirectiveOptions are the options that follow a directive, such as "indent=4" and "sort-keys" in
+// `//gofmts:json indent=4 sort-keys`.  An option given without a value is stored with an empty value.
+type DirectiveOptions map[string]string
+
+// Bool returns true if the option is present without a value, otherwise the value is parsed as a boolean
+func (o DirectiveOptions) Bool(name string) (bool, error) {
+	value, ok := o[name]
+	if !ok {
+		return false, nil
+	}
+	if value == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Errorf("option %q must be a boolean", name)
+	}
+	return b, nil
+}
+
+// Int returns the integer value of the option or "defaultValue" if the option is absent
+func (o DirectiveOptions) Int(name string, defaultValue int) (int, error) {
+	value, ok := o[name]
+	if !ok {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Errorf("option %q must be an integer", name)
+	}
+	return i, nil
+}
+
+// Choice returns the value of the option, which must be one of "choices", or the first choice if the option is absent
+func (o DirectiveOptions) Choice(name string, choices ...string) (string, error) {
+	value, ok := o[name]
+	if !ok {
+		return choices[0], nil
+	}
+	for _, c := range choices {
+		if value == c {
+			return value, nil
+		}
+	}
+	return "", errors.Errorf("option %q must be one of %s", name, strings.Join(choices, ", "))
+}
+
+// directiveIndex holds the directives of a file in order, so that the closest one to a node can be found without
+// looking at them all
+type directiveIndex struct {
+	entries []indexedDirective
+	live    []int // for each entry, itself unless it has been consumed, otherwise an earlier entry to look at instead
+}
+
+type indexedDirective struct {
+	pos  token.Pos
+	line int
+	directive
+}
+
+func newDirectiveIndex(fset *token.FileSet, directivesByPos map[token.Pos]directive) *directiveIndex {
+	x := &directiveIndex{
+		entries: make([]indexedDirective, 0, len(directivesByPos)),
+		live:    make([]int, len(directivesByPos)),
+	}
+	for pos, d := range directivesByPos {
+		x.entries = append(x.entries, indexedDirective{pos: pos, line: fset.Position(pos).Line, directive: d})
+	}
+	sort.Slice(x.entries, func(i, j int) bool { return x.entries[i].pos < x.entries[j].pos })
+	for i := range x.live {
+		x.live[i] = i
+	}
+	return x
+}
+
+// closest returns the last directive on or before "line" that hasn't been consumed, or token.NoPos if there is none
+func (x *directiveIndex) closest(line int) (token.Pos, directive) {
+	i := sort.Search(len(x.entries), func(i int) bool { return x.entries[i].line > line })
+	if i = x.findLive(i - 1); i < 0 {
+		return token.NoPos, directive{}
+	}
+	return x.entries[i].pos, x.entries[i].directive
+}
+
+// findLive returns the last entry at or before "i" that hasn't been consumed, or -1 if there is none
+func (x *directiveIndex) findLive(i int) int {
+	root := i
+	for root >= 0 && x.live[root] != root {
+		root = x.live[root]
+	}
+	// point the consumed entries that we passed straight at the one we found
+	for i >= 0 && x.live[i] != i {
+		i, x.live[i] = x.live[i], root
+	}
+	return root
+}
+
+// consume removes the directive at "pos", which may then be reported as used
+func (x *directiveIndex) consume(pos token.Pos) {
+	i := sort.Search(len(x.entries), func(i int) bool { return x.entries[i].pos >= pos })
+	if i < len(x.entries) && x.entries[i].pos == pos {
+		x.live[i] = i - 1
+	}
+}
+
+// remaining returns the directives that haven't been consumed, in order
+func (x *directiveIndex) remaining() []indexedDirective {
+	var remaining []indexedDirective
+	for i, e := range x.entries {
+		if x.live[i] == i {
+			remaining = append(remaining, e)
+		}
+	}
+	return remaining
+}
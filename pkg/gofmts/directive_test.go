@@ -0,0 +1,108 @@
+package gofmts
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectiveIndex(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("p.go", -1, 100)
+	file.SetLines([]int{0, 10, 20, 30, 40, 50})
+	pos := func(line int) token.Pos { return file.LineStart(line) + 2 }
+	x := newDirectiveIndex(fset, map[token.Pos]directive{
+		pos(2): {name: "a"},
+		pos(3): {name: "b"},
+		pos(5): {name: "c"},
+	})
+
+	p, d := x.closest(1)
+	assert.Equal(t, token.NoPos, p)
+	p, d = x.closest(4)
+	assert.Equal(t, pos(3), p)
+	assert.Equal(t, "b", d.name)
+
+	x.consume(pos(3))
+	p, d = x.closest(4)
+	assert.Equal(t, pos(2), p)
+	assert.Equal(t, "a", d.name)
+	x.consume(pos(2))
+	p, _ = x.closest(4)
+	assert.Equal(t, token.NoPos, p)
+	p, _ = x.closest(6)
+	assert.Equal(t, pos(5), p)
+
+	require.Len(t, x.remaining(), 1)
+	assert.Equal(t, "c", x.remaining()[0].name)
+}
+
+func TestSourceScaling(t *testing.T) {
+	if testing.Short() {
+		t.Skip("formats thousands of directives")
+	}
+	// perDirective returns the fastest time and the allocations that Source takes for each directive in a file of "n"
+	perDirective := func(n int) (time.Duration, float64) {
+		src := []byte(directiveFixture(n))
+		fastest := time.Duration(math.MaxInt64)
+		allocs := testing.AllocsPerRun(3, func() {
+			start := time.Now()
+			_, issues, err := Source(src, Options{Filename: "p.go"})
+			if elapsed := time.Since(start); elapsed < fastest {
+				fastest = elapsed
+			}
+			require.NoError(t, err)
+			require.Len(t, issues, 2*n)
+		})
+		return fastest / time.Duration(2*n), allocs / float64(2*n)
+	}
+	// the cost of each directive should stay about the same, rather than growing tenfold with ten times as many
+	smallTime, smallAllocs := perDirective(100)
+	largeTime, largeAllocs := perDirective(1000)
+	assert.Less(t, float64(largeTime), 4*float64(smallTime), "time per directive: %s, then %s", smallTime, largeTime)
+	assert.Less(t, largeAllocs, 2*smallAllocs, "allocations per directive: %.0f, then %.0f", smallAllocs, largeAllocs)
+}
+
+// directiveFixture returns a file with "n" strings to format and "n" blocks to sort, like a large generated file
+func directiveFixture(n int) string {
+	var b strings.Builder
+	b.WriteString("package p\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "\n//gofmts:json\nconst j%d = `[%d,2]`\n", i, i)
+		fmt.Fprintf(&b, "\nconst (\n\t//gofmts:sort\n\tb%d = 1\n\ta%d = 2\n)\n", i, i)
+		fmt.Fprintf(&b, "\nvar v%d = map[string]int{\"x\": %d}\n", i, i)
+	}
+	return b.String()
+}
+
+// BenchmarkDirectives runs the formatter and sorter on files with more and more directives.  The time per directive
+// should stay about the same as the number of directives grows.
+func BenchmarkDirectives(b *testing.B) {
+	for _, n := range []int{100, 1000, 5000} {
+		b.Run(fmt.Sprintf("directives=%d", 2*n), func(b *testing.B) {
+			src := []byte(directiveFixture(n))
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+			require.NoError(b, err)
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				d, err := decorateFile(fset, file)
+				require.NoError(b, err)
+				issues, _ := NewFormatter().run(d, src)
+				sortIssues, _ := NewSorter().run(d)
+				if len(issues) != n || len(sortIssues) != n {
+					b.Fatalf("found %d format and %d sort issues", len(issues), len(sortIssues))
+				}
+			}
+			b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*2*n), "ns/directive")
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package gofmts
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Edit replaces the bytes of a source from offset Start up to offset End with the replacement of Issue
+type Edit struct {
+	Start, End int
+	Issue      IssueWithReplacement
+}
+
+func (e Edit) NewText() string {
+	return e.Issue.Replacement()
+}
+
+// overlaps reports whether two edits can't both be applied.  Insertions at the same offset conflict because the order
+// in which to make them is ambiguous.
+func (e Edit) overlaps(o Edit) bool {
+	return e.Start == o.Start || e.Start < o.End && o.Start < e.End
+}
+
+// Edits are the changes to a single source that fix a set of issues
+type Edits []Edit
+
+// NewEdits returns the edits that fix "issues", along with the issues that have no replacement.  The edits are
+// resolved, so issues whose edits overlap others are also returned, as EditConflicts.
+func NewEdits(issues []Issue) (Edits, []Issue) {
+	var edits Edits
+	var unresolved []Issue
+	for _, i := range issues {
+		fix, ok := i.(IssueWithReplacement)
+		if !ok {
+			unresolved = append(unresolved, i)
+			continue
+		}
+		edits = append(edits, Edit{Start: fix.Position().Offset, End: fix.End().Offset, Issue: fix})
+	}
+	edits, conflicts := edits.Resolve()
+	return edits, append(unresolved, conflicts...)
+}
+
+// Resolve sorts the edits by offset and removes those that overlap an earlier one, returning an EditConflict for each.
+// Where edits overlap, the one that starts first is kept, and of those that start at the same offset, the longest,
+// so that an edit to part of a sorted block gives way to the sorting of the whole block.  Identical edits are merged.
+func (e Edits) Resolve() (Edits, []Issue) {
+	sorted := make(Edits, len(e))
+	copy(sorted, e)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		if sorted[a].Start != sorted[b].Start {
+			return sorted[a].Start < sorted[b].Start
+		}
+		return sorted[a].End > sorted[b].End
+	})
+	var resolved Edits
+	var conflicts []Issue
+	for _, edit := range sorted {
+		if len(resolved) > 0 {
+			prev := resolved[len(resolved)-1]
+			if edit.Start == prev.Start && edit.End == prev.End && edit.NewText() == prev.NewText() {
+				continue
+			}
+			if edit.overlaps(prev) {
+				conflicts = append(conflicts, EditConflict{issue: edit.Issue, with: prev.Issue})
+				continue
+			}
+		}
+		resolved = append(resolved, edit)
+	}
+	return resolved, conflicts
+}
+
+// Apply returns a copy of "src" with the edits made.  The edits must be resolved.
+func (e Edits) Apply(src []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(len(src))
+	if err := e.Copy(buf, bytes.NewReader(src)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Copy copies "r" to "w", making the edits along the way.  The edits must be resolved.
+func (e Edits) Copy(w io.Writer, r io.Reader) error {
+	offset := 0
+	for _, edit := range e {
+		if edit.Start < offset || edit.End < edit.Start {
+			return errors.Errorf("edit at offset %d is out of order", edit.Start)
+		}
+		if _, err := io.CopyN(w, r, int64(edit.Start-offset)); err != nil {
+			return errors.Wrapf(err, "failed to copy source up to offset %d", edit.Start)
+		}
+		if _, err := io.WriteString(w, edit.NewText()); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, int64(edit.End-edit.Start)); err != nil {
+			return errors.Wrapf(err, "failed to skip source up to offset %d", edit.End)
+		}
+		offset = edit.End
+	}
+	// copy the rest
+	_, err := io.Copy(w, r)
+	return err
+}
+
+// ApplyReplacements copies "r" to "w" with the replacements for "issues" made, returning the issues that couldn't be
+// fixed
+func ApplyReplacements(w io.Writer, r io.Reader, issues []Issue) (unresolvedIssues []Issue, _ error) {
+	edits, unresolved := NewEdits(issues)
+	return unresolved, edits.Copy(w, r)
+}
+
+// EditConflict is an issue whose replacement overlaps that of another issue, so it can't be fixed until the other one
+// is
+type EditConflict struct {
+	issue IssueWithReplacement
+	with  IssueWithReplacement
+}
+
+func (i EditConflict) Details() string {
+	return fmt.Sprintf("%s (conflicts with %s at %s)", i.issue.Details(), i.with.Details(), i.with.Position())
+}
+
+func (i EditConflict) Pos() token.Pos {
+	return i.issue.Pos()
+}
+
+func (i EditConflict) Position() token.Position {
+	return i.issue.Position()
+}
+
+func (i EditConflict) String() string { return toString(i) }
+
+func (i EditConflict) Directive() string {
+	if d, ok := i.issue.(IssueWithDirective); ok {
+		return d.Directive()
+	}
+	return ""
+}
+
+// Issue returns the issue that couldn't be fixed
+func (i EditConflict) Issue() IssueWithReplacement { return i.issue }
@@ -0,0 +1,186 @@
+package gofmts
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replacementIssue(start, end int, replacement string) FormatIssue {
+	return FormatIssue{
+		directive:   "test",
+		position:    token.Position{Offset: start},
+		end:         token.Position{Offset: end},
+		replacement: replacement,
+	}
+}
+
+func TestEdits(t *testing.T) {
+	t.Run("edits are applied in order of offset", func(t *testing.T) {
+		edits, unresolved := NewEdits([]Issue{
+			replacementIssue(6, 11, "there"),
+			UnknownDirective{directive: "x"},
+			replacementIssue(0, 5, "bye"),
+			replacementIssue(11, 11, "!"),
+		})
+		assert.Equal(t, []Issue{UnknownDirective{directive: "x"}}, unresolved)
+		result, err := edits.Apply([]byte("hello world"))
+		require.NoError(t, err)
+		assert.Equal(t, "bye there!", string(result))
+	})
+
+	t.Run("identical edits are merged", func(t *testing.T) {
+		edits, unresolved := NewEdits([]Issue{replacementIssue(0, 1, "b"), replacementIssue(0, 1, "b")})
+		assert.Empty(t, unresolved)
+		assert.Len(t, edits, 1)
+	})
+
+	t.Run("an edit inside another is reported as a conflict", func(t *testing.T) {
+		outer := replacementIssue(2, 8, "sorted")
+		inner := replacementIssue(4, 5, "formatted")
+		edits, unresolved := NewEdits([]Issue{inner, outer})
+		require.Len(t, edits, 1)
+		assert.Equal(t, outer, edits[0].Issue)
+		require.Len(t, unresolved, 1)
+		conflict := unresolved[0].(EditConflict)
+		assert.Equal(t, inner, conflict.Issue())
+		assert.Equal(t, "test formatting differs (conflicts with test formatting differs at -)", conflict.Details())
+	})
+
+	t.Run("insertions at the same offset conflict", func(t *testing.T) {
+		_, unresolved := NewEdits([]Issue{replacementIssue(3, 3, "a"), replacementIssue(3, 3, "b")})
+		assert.Len(t, unresolved, 1)
+	})
+
+	t.Run("edits past the end of the source fail", func(t *testing.T) {
+		edits, _ := NewEdits([]Issue{replacementIssue(3, 10, "")})
+		_, err := edits.Apply([]byte("abcd"))
+		assert.Error(t, err)
+	})
+
+	t.Run("sort and format issues in the same file", func(t *testing.T) {
+		src := []byte(strings.Join([]string{
+			"package p",
+			"",
+			"const (",
+			"	//gofmts:sort",
+			"	Z = 1",
+			"	//gofmts:json",
+			"	A = `[1,2]`",
+			")",
+			"",
+			"//gofmts:json",
+			"const B = `[3,4]`",
+			"",
+		}, "\n"))
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+		require.NoError(t, err)
+		issues, err := NewFormatter().Run(src, fset, file)
+		require.NoError(t, err)
+		sortIssues, err := NewSorter().Run(fset, file)
+		require.NoError(t, err)
+		issues = append(issues, sortIssues...)
+		require.Len(t, issues, 3)
+
+		edits, unresolved := NewEdits(issues)
+		require.Len(t, unresolved, 1)
+		assert.IsType(t, FormatIssue{}, unresolved[0].(EditConflict).Issue())
+		result, err := edits.Apply(src)
+		require.NoError(t, err)
+		assert.Equal(t, strings.Join([]string{
+			"package p",
+			"",
+			"const (",
+			"	//gofmts:sort",
+			"	//gofmts:json",
+			"	A = `[1,2]`",
+			"	Z = 1",
+			")",
+			"",
+			"//gofmts:json",
+			"const B = `",
+			"		[3, 4]",
+			"		`",
+			"",
+		}, "\n"), string(result))
+	})
+}
+
+// TestEditsProperties checks random sets of edits against a simple model: edits that survive resolution are sorted and
+// disjoint, every edit is either kept, merged with an identical one or reported as a conflict, and applying the edits
+// to bytes or to a reader gives the same result as making them one at a time from the end of the source.
+func TestEditsProperties(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const alphabet = "abc\n\t"
+	randomString := func(n int) string {
+		b := make([]byte, rnd.Intn(n+1))
+		for i := range b {
+			b[i] = alphabet[rnd.Intn(len(alphabet))]
+		}
+		return string(b)
+	}
+
+	for iteration := 0; iteration < 1000; iteration++ {
+		src := randomString(40)
+		var issues []Issue
+		for n := rnd.Intn(8); n > 0; n-- {
+			start := rnd.Intn(len(src) + 1)
+			end := start + rnd.Intn(len(src)-start+1)
+			issues = append(issues, replacementIssue(start, end, randomString(5)))
+			if rnd.Intn(4) == 0 {
+				issues = append(issues, issues[rnd.Intn(len(issues))]) // a duplicate
+			}
+		}
+
+		edits, unresolved := NewEdits(issues)
+
+		for i := 1; i < len(edits); i++ {
+			require.True(t, edits[i-1].End <= edits[i].Start && edits[i-1].Start < edits[i].Start,
+				"edits %v and %v overlap", edits[i-1], edits[i])
+		}
+		for _, i := range unresolved {
+			conflict, ok := i.(EditConflict)
+			require.True(t, ok)
+			assert.Contains(t, edits, Edit{
+				Start: conflict.with.Position().Offset, End: conflict.with.End().Offset, Issue: conflict.with,
+			})
+		}
+		for _, i := range issues {
+			fix := i.(IssueWithReplacement)
+			kept := false
+			for _, edit := range edits {
+				kept = kept || edit.Start == fix.Position().Offset && edit.End == fix.End().Offset &&
+					edit.NewText() == fix.Replacement()
+			}
+			conflicted := false
+			for _, u := range unresolved {
+				conflicted = conflicted || u.(EditConflict).Issue() == fix
+			}
+			require.True(t, kept || conflicted, "issue %v was dropped", fix)
+		}
+
+		expected := src
+		sorted := append(Edits(nil), edits...)
+		sort.Slice(sorted, func(a, b int) bool { return sorted[a].Start > sorted[b].Start })
+		for _, edit := range sorted {
+			expected = expected[:edit.Start] + edit.NewText() + expected[edit.End:]
+		}
+
+		result, err := edits.Apply([]byte(src))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(result), "source %q, edits %v", src, edits)
+
+		buf := new(bytes.Buffer)
+		require.NoError(t, edits.Copy(buf, iotest.OneByteReader(strings.NewReader(src))))
+		require.Equal(t, expected, buf.String())
+	}
+}
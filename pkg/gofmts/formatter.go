@@ -11,14 +11,14 @@ import (
 	"go/token"
 	"io"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/dave/dst"
 	"github.com/dave/dst/decorator"
-	"github.com/dave/dst/dstutil"
-	"github.com/jackc/sqlfmt"
 	"github.com/pkg/errors"
 	"github.com/tidwall/pretty"
+	"gopkg.in/yaml.v3"
 )
 
 const tabWidth = 8
@@ -30,24 +30,52 @@ type Issue interface {
 	String() string
 }
 
+// IssueWithDirective is an issue that names the directive it was found for, such as "json" or "sort"
+type IssueWithDirective interface {
+	Issue
+	Directive() string
+}
+
 type IssueWithReplacement interface {
 	Issue
 	Replacement() string
 	Length() int
+	End() token.Position
 }
 
 type Formatter struct {
+	aliases           map[string]string
 	applyReplacements bool
+	defaultOptions    map[string]DirectiveOptions
+	disabled          map[string]bool
+	registry          *Registry
+	tabWidth          int
 }
 
 const directivePrefix = "gofmts:"
 
 func NewFormatter() *Formatter {
-	return &Formatter{}
+	return &Formatter{
+		aliases:        make(map[string]string),
+		defaultOptions: make(map[string]DirectiveOptions),
+		disabled:       make(map[string]bool),
+		registry:       NewRegistry(),
+		tabWidth:       tabWidth,
+	}
+}
+
+// Register adds a formatter for the directive `//gofmts:<name>`, which accepts the directive options listed in "options"
+func (f *Formatter) Register(name string, sf StringFormatter, options ...string) {
+	f.registry.Register(name, sf, options...)
 }
 
 func FormatFile(src []byte, fset *token.FileSet, file *ast.File) ([]Issue, error) {
-	fmtr := NewFormatter()
+	return NewFormatter().FormatFile(src, fset, file)
+}
+
+// FormatFile calculates the issues and applies the replacements to "file"
+func (f *Formatter) FormatFile(src []byte, fset *token.FileSet, file *ast.File) ([]Issue, error) {
+	fmtr := *f
 	fmtr.applyReplacements = true
 	return fmtr.Run(src, fset, file)
 }
@@ -76,6 +104,12 @@ func (i FormatIssue) Length() int {
 	return i.end.Offset - i.position.Offset
 }
 
+func (i FormatIssue) End() token.Position {
+	return i.end
+}
+
+func (i FormatIssue) Directive() string { return i.directive }
+
 func (i FormatIssue) String() string { return toString(i) }
 
 func (i FormatIssue) Replacement() string { return i.replacement }
@@ -104,6 +138,8 @@ func (i UnusedDirective) Position() token.Position {
 
 func (i UnusedDirective) String() string { return toString(i) }
 
+func (i UnusedDirective) Directive() string { return i.name }
+
 type UnknownDirective struct {
 	directive string
 	pos       token.Pos
@@ -124,6 +160,8 @@ func (i UnknownDirective) Position() token.Position {
 
 func (i UnknownDirective) String() string { return toString(i) }
 
+func (i UnknownDirective) Directive() string { return i.directive }
+
 type FailedDirective struct {
 	directive string
 	pos       token.Pos
@@ -145,110 +183,137 @@ func (i FailedDirective) Position() token.Position {
 
 func (i FailedDirective) String() string { return toString(i) }
 
+func (i FailedDirective) Directive() string { return i.directive }
+
+type UnknownOption struct {
+	directive string
+	option    string
+	pos       token.Pos
+	position  token.Position
+}
+
+func (i UnknownOption) Details() string {
+	return fmt.Sprintf("unknown option %q for directive `%s%s`", i.option, directivePrefix, i.directive)
+}
+
+func (i UnknownOption) Pos() token.Pos {
+	return i.pos
+}
+
+func (i UnknownOption) Position() token.Position {
+	return i.position
+}
+
+func (i UnknownOption) String() string { return toString(i) }
+
+func (i UnknownOption) Directive() string { return i.directive }
+
 type formatVisitor struct {
-	decorator       *decorator.Decorator
-	directivesByPos map[token.Pos]string
-	fset            *token.FileSet
-	issues          []Issue
-	issuesByNode    map[dst.Node]Issue
-	prevNode        dst.Node
-	src             []byte
+	decorator    *decorator.Decorator
+	directives   *directiveIndex
+	fset         *token.FileSet
+	issues       []Issue
+	issuesByNode map[dst.Node]Issue
+	formatter    *Formatter
+	prevNode     dst.Node
+	src          []byte
 }
 
-var directivePattern = regexp.MustCompile(`//` + directivePrefix + `\s*(\S+)\s*(//.*)?`)
+// directivePattern matches a directive comment, which must start with the directive rather than mention it in its text
+var directivePattern = regexp.MustCompile(`^//` + directivePrefix + `\s*(\S+)((?:\s+[^\s/]\S*)*)\s*(//.*)?`)
 
 // Run calculates the issues.  "src" is the representation of the source, which is used to determine the next tab stop for indentation
 func (f *Formatter) Run(src []byte, fset *token.FileSet, file *ast.File) ([]Issue, error) {
-	var issues []Issue // nolint:prealloc // don't know how many there will be
-	dcrtr := decorator.NewDecorator(fset)
-	dstFile, err := dcrtr.DecorateFile(file)
+	d, err := decorateFile(fset, file)
 	if err != nil {
-		return nil, errors.Wrapf(err, "decorate failed")
+		return nil, err
+	}
+	issues, changed := f.run(d, src)
+	if f.applyReplacements && changed {
+		_, af, err := d.restore()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to reformat node")
+		}
+		*file = *af
 	}
+	return issues, nil
+}
 
-	directivesByPos := make(map[token.Pos]string) // nolint:prealloc // don't know how many there will be
-	issuesByNode := make(map[dst.Node]Issue)      // nolint:prealloc // don't know how many there will be
-	for _, group := range file.Comments {
+// run finds the issues in a decorated file and replaces the strings that need formatting in its tree, reporting
+// whether there were any
+func (f *Formatter) run(d *decoratedFile, src []byte) (issues []Issue, changed bool) {
+	directivesByPos := make(map[token.Pos]directive) // nolint:prealloc // don't know how many there will be
+	issuesByNode := make(map[dst.Node]Issue)         // nolint:prealloc // don't know how many there will be
+	for _, group := range d.ast.Comments {
 		for _, comment := range group.List {
 			matches := directivePattern.FindStringSubmatch(comment.Text)
 			if matches != nil {
-				// ignore sort directives
-				if matches[1] != "sort" {
-					directivesByPos[comment.End()] = matches[1]
+				// ignore sort directives and those that have been disabled, either by name or through their alias
+				if matches[1] != "sort" && !f.disabled[matches[1]] && !f.disabled[f.resolveAlias(matches[1])] {
+					directivesByPos[comment.End()] = parseDirective(matches[1], matches[2])
 				}
 			}
 		}
 	}
 	visitor := formatVisitor{
 		//gofmts:sort
-		decorator:       dcrtr,
-		directivesByPos: directivesByPos,
-		fset:            fset,
-		issuesByNode:    issuesByNode,
-		src:             src,
+		decorator:    d.decorator,
+		directives:   newDirectiveIndex(d.fset, directivesByPos),
+		formatter:    f,
+		fset:         d.fset,
+		issuesByNode: issuesByNode,
+		src:          src,
 	}
-	dst.Walk(&visitor, dstFile)
+	dst.Walk(&visitor, d.dst)
 	issues = append(issues, visitor.issues...)
-	for pos, d := range directivesByPos {
-		issues = append(issues, UnusedDirective{name: d, pos: pos, position: fset.Position(pos)})
-	}
-
-	// apply replacements
-	if f.applyReplacements && len(visitor.issues) > 0 {
-		dstutil.Apply(dstFile, nil, func(c *dstutil.Cursor) bool {
-			switch node := c.Node().(type) {
-			case *dst.BasicLit:
-				issue, exists := issuesByNode[c.Node()].(IssueWithReplacement)
-				if !exists {
-					break
-				}
-				replacementNode := dst.Clone(node).(*dst.BasicLit)
-				replacementNode.Value = issue.Replacement()
-				c.Replace(replacementNode)
-			}
-			return true
-		})
+	for _, dir := range visitor.directives.remaining() {
+		issues = append(issues, UnusedDirective{name: dir.name, pos: dir.pos, position: d.fset.Position(dir.pos)})
+	}
 
-		restorer := decorator.NewRestorer()
-		restorer.Fset = fset
-		af, err := restorer.RestoreFile(dstFile)
-		if err != nil {
-			return nil, errors.Wrapf(err, "unable to reformat node")
+	// replace the strings in place, so that the decorator can still find the nodes, such as when sorting them
+	for node, issue := range issuesByNode {
+		if issue, ok := issue.(IssueWithReplacement); ok {
+			node.(*dst.BasicLit).Value = issue.Replacement()
+			changed = true
 		}
-		*file = *af
 	}
-	return issues, nil
+	return issues, changed
 }
 
 func (v *formatVisitor) Visit(node dst.Node) dst.Visitor {
-ParseNode:
 	switch node := node.(type) {
 	case *dst.BasicLit:
 		if node.Kind == token.STRING {
 			astNode := v.decorator.Ast.Nodes[node]
-			closestDirectivePos, closestDirective := findClosestDirective(v.fset, v.directivesByPos, astNode, false)
+			closestDirectivePos, d := findClosestDirective(v.fset, v.directives, astNode, false)
 			if !closestDirectivePos.IsValid() {
 				break
 			}
-			delete(v.directivesByPos, closestDirectivePos) // consume directive
+			closestDirective := d.name
+			v.directives.consume(closestDirectivePos)
 			value := node.Value[1 : len(node.Value)-1]
-			var newValue string
-			var err error
-			switch closestDirective {
-			case "json":
-				newValue, err = formatJson(value)
-			case "mysql", "postgresql", "sql":
-				newValue, err = formatSql(value)
-			case "go":
-				newValue, err = formatGo(value)
-			default:
+			name := v.formatter.resolveAlias(closestDirective)
+			formatter, known := v.formatter.registry.Lookup(name)
+			if !known {
 				v.issues = append(v.issues, UnknownDirective{
 					directive: closestDirective,
 					pos:       closestDirectivePos,
 					position:  v.fset.Position(closestDirectivePos),
 				})
-				break ParseNode
+				break
+			}
+			if unknownOptions := v.unknownOptions(name, d, closestDirectivePos); len(unknownOptions) > 0 {
+				v.issues = append(v.issues, unknownOptions...)
+				break
 			}
+			options := make(DirectiveOptions)
+			for k, o := range v.formatter.defaultOptions[name] {
+				options[k] = o
+			}
+			for k, o := range d.options {
+				options[k] = o
+			}
+			newValue, err := formatter.Format(value, options)
 			if err != nil {
 				v.issues = append(v.issues, FailedDirective{
 					directive: closestDirective,
@@ -284,9 +349,11 @@ ParseNode:
 				columnByteOffset := position.Column
 				indentSpaces := columnByteOffset // by default assume, everything take a character
 
+				tabWidth := v.formatter.tabWidth
+
 				// if we have the source data, start at the next tab stop
 				if v.src != nil {
-					spaces := countSpaces(string(v.src[position.Offset-position.Column : position.Offset]))
+					spaces := countSpaces(string(v.src[position.Offset-position.Column : position.Offset]), tabWidth)
 					indentSpaces = ((spaces / tabWidth) + 1) * tabWidth
 				} else {
 
@@ -299,7 +366,7 @@ ParseNode:
 					indentSpaces += tabWidth
 				}
 
-				iw := NewIndentWriter(replacementBuf, indentSpaces, tabWidth /* tab width */)
+				iw := NewIndentWriter(replacementBuf, indentSpaces, tabWidth)
 				_ = iw.WriteString(newValue, false)
 				_ = iw.WriteString(node.Value[len(node.Value)-1:], true)
 			} else {
@@ -329,54 +396,160 @@ ParseNode:
 	return v
 }
 
-func findClosestDirective(fset *token.FileSet, directivesByPos map[token.Pos]string, node ast.Node, ignoreInline bool) (pos token.Pos, directive string) {
-	pos = token.NoPos
-	for p, d := range directivesByPos {
-		directiveStartLine := fset.Position(p).Line
-		var applies bool
-		if ignoreInline {
-			nodeStartLine := fset.Position(node.Pos()).Line
-			applies = directiveStartLine <= nodeStartLine
-		} else {
-			nodeEndLine := fset.Position(node.End()).Line
-			applies = directiveStartLine <= nodeEndLine
-		}
-		if applies && p > pos {
-			pos = p
-			directive = d
+func (f *Formatter) resolveAlias(name string) string {
+	if target, ok := f.aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+func (v *formatVisitor) unknownOptions(formatterName string, d directive, pos token.Pos) []Issue {
+	var names []string
+	for name := range d.options {
+		if !v.formatter.registry.acceptsOption(formatterName, name) {
+			names = append(names, name)
 		}
 	}
-	return pos, directive
+	sort.Strings(names)
+	issues := make([]Issue, 0, len(names))
+	for _, name := range names {
+		issues = append(issues, UnknownOption{
+			directive: d.name,
+			option:    name,
+			pos:       pos,
+			position:  v.fset.Position(pos),
+		})
+	}
+	return issues
+}
+
+// findClosestDirective returns the last directive before "node" that hasn't been consumed.  Unless "ignoreInline" is
+// set, a directive may also be on the line where the node ends.
+func findClosestDirective(fset *token.FileSet, directives *directiveIndex, node ast.Node, ignoreInline bool) (token.Pos, directive) {
+	if ignoreInline {
+		return directives.closest(fset.Position(node.Pos()).Line)
+	}
+	return directives.closest(fset.Position(node.End()).Line)
 }
 
-func formatJson(value string) (string, error) {
+var jsonOptions = []string{"compact", "indent", "sort-keys", "width"}
+
+func formatJson(value string, opts DirectiveOptions) (string, error) {
 	if valid := json.Valid([]byte(value)); !valid {
 		return "", errors.New("json is not valid")
 	}
-	newValue := pretty.Pretty([]byte(value))
+	compact, err := opts.Bool("compact")
+	if err != nil {
+		return "", err
+	}
+	indent, err := opts.Int("indent", 2)
+	if err != nil {
+		return "", err
+	}
+	sortKeys, err := opts.Bool("sort-keys")
+	if err != nil {
+		return "", err
+	}
+	width, err := opts.Int("width", pretty.DefaultOptions.Width)
+	if err != nil {
+		return "", err
+	}
+	newValue := pretty.PrettyOptions([]byte(value), &pretty.Options{
+		Width:    width,
+		Indent:   strings.Repeat(" ", indent),
+		SortKeys: sortKeys,
+	})
+	if compact {
+		newValue = bytes.TrimSuffix(pretty.Ugly(newValue), []byte("\n"))
+	}
 	return string(newValue), nil
 }
 
-func formatSql(value string) (string, error) {
-	lexer := sqlfmt.NewSqlLexer(value)
-	stmt, err := sqlfmt.Parse(lexer)
+func formatGo(value string, _ DirectiveOptions) (string, error) {
+	formatted, err := format.Source([]byte(value))
 	if err != nil {
-		return "", errors.Wrapf(err, "unable to parse sql")
+		return "", errors.Wrapf(err, "unable to format go code")
 	}
+	return string(formatted), nil
+}
+
+var yamlOptions = []string{"indent"}
 
+func formatYaml(value string, opts DirectiveOptions) (string, error) {
+	indent, err := opts.Int("indent", 2)
+	if err != nil {
+		return "", err
+	}
+	// strip the indentation of a string that was formatted before, since yaml doesn't allow tabs as indentation
+	decoder := yaml.NewDecoder(strings.NewReader(dedent(value)))
 	outBuf := new(bytes.Buffer)
-	r := sqlfmt.NewTextRenderer(outBuf)
-	r.UpperCase = true
-	stmt.RenderTo(r)
+	encoder := yaml.NewEncoder(outBuf)
+	encoder.SetIndent(indent)
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "yaml is not valid")
+		}
+		normalizeYamlStyle(&doc)
+		// the encoder separates each document after the first with "---"
+		if err := encoder.Encode(&doc); err != nil {
+			return "", errors.Wrapf(err, "unable to format yaml")
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return "", errors.Wrapf(err, "unable to format yaml")
+	}
+	if startsWithYamlSeparator(value) {
+		// the encoder only writes "---" between documents
+		return "---\n" + outBuf.String(), nil
+	}
 	return outBuf.String(), nil
 }
 
-func formatGo(value string) (string, error) {
-	formatted, err := format.Source([]byte(value))
-	if err != nil {
-		return "", errors.Wrapf(err, "unable to format go code")
+// startsWithYamlSeparator reports whether the first document of "value" is started explicitly with "---"
+func startsWithYamlSeparator(value string) bool {
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return line == "---" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "---\t")
+	}
+	return false
+}
+
+// normalizeYamlStyle drops quoting and flow styles so that they are only used where required, but retains literal and
+// folded block scalars, which are typically used to keep multiline text readable
+func normalizeYamlStyle(node *yaml.Node) {
+	if node.Kind != yaml.ScalarNode || !needsYamlQuotes(node.Value) {
+		node.Style &= yaml.LiteralStyle | yaml.FoldedStyle
+	}
+	for _, child := range node.Content {
+		normalizeYamlStyle(child)
 	}
-	return string(formatted), nil
+}
+
+// yaml11Scalar matches the plain scalars that YAML 1.1 reads as booleans or numbers although YAML 1.2 reads them as
+// strings, such as "yes", "off" and "1:30"
+var yaml11Scalar = regexp.MustCompile(`^(?:[yYnN]|yes|Yes|YES|no|No|NO|on|On|ON|off|Off|OFF|` +
+	`[-+]?0b[01_]+|[-+]?[0-9][0-9_]*(?::[0-5]?[0-9])+(?:\.[0-9_]*)?)$`)
+
+// needsYamlQuotes reports whether "value" would be read as something other than a string without its quotes, either
+// by YAML 1.2 or by YAML 1.1 consumers such as Kubernetes
+func needsYamlQuotes(value string) bool {
+	if yaml11Scalar.MatchString(value) {
+		return true
+	}
+	var plain interface{}
+	if err := yaml.Unmarshal([]byte(value), &plain); err != nil {
+		return true
+	}
+	_, ok := plain.(string)
+	return !ok
 }
 
 type indentWriter struct {
@@ -410,7 +583,31 @@ func (w indentWriter) WriteString(p string, skipNewline bool) error {
 	return nil
 }
 
-func countSpaces(str string) (count int) {
+// dedent removes the whitespace that prefixes every non-blank line of "str"
+func dedent(str string) string {
+	lines := strings.Split(str, "\n")
+	prefix := ""
+	found := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !found {
+			prefix, found = indent, true
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, prefix)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func countSpaces(str string, tabWidth int) (count int) {
 	for _, char := range str {
 		if char == '\t' {
 			count += tabWidth
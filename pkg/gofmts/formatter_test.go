@@ -1,6 +1,7 @@
 package gofmts
 
 import (
+	"bytes"
 	"go/ast"
 	"go/format"
 	"go/parser"
@@ -13,16 +14,18 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func makeFormatterInputs(t *testing.T, src string) ([]byte, *token.FileSet, *ast.File) {
+	fset := token.NewFileSet()
+	src = strings.TrimLeftFunc(src, unicode.IsSpace)
+	formatted, err := format.Source([]byte(src))
+	require.NoError(t, err)
+	f, err := parser.ParseFile(fset, "", string(formatted), parser.ParseComments)
+	require.NoError(t, err)
+	return formatted, fset, f
+}
+
 func TestFormatter(t *testing.T) {
-	makeInputs := func(t *testing.T, src string) ([]byte, *token.FileSet, *ast.File) {
-		fset := token.NewFileSet()
-		src = strings.TrimLeftFunc(src, unicode.IsSpace)
-		formatted, err := format.Source([]byte(src))
-		require.NoError(t, err)
-		f, err := parser.ParseFile(fset, "", string(formatted), parser.ParseComments)
-		require.NoError(t, err)
-		return formatted, fset, f
-	}
+	makeInputs := makeFormatterInputs
 
 	fmtr := NewFormatter()
 
@@ -157,6 +160,19 @@ func TestFormatter(t *testing.T) {
 		assert.Equal(t, 3, issues[0].Position().Line)
 	})
 
+	t.Run("directives mentioned in the text of a comment are ignored", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				// value is formatted with //gofmts:json
+				const value = "[1,2]"
+				`))
+		require.NoError(t, err)
+		assert.Empty(t, issues)
+	})
+
 	t.Run("go directive formats go code", func(t *testing.T) {
 		issues, err := fmtr.Run(makeInputs(t,
 			//gofmts:go
@@ -189,4 +205,197 @@ func TestFormatter(t *testing.T) {
 			issues[0].Details())
 		assert.Equal(t, 3, issues[0].Position().Line)
 	})
+
+	t.Run("yaml directive reformats yaml", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:yaml
+				const yaml = `+"`\n# comment\na:   1\nb:\n    - 'x'\n---\nc: {d: 1}`"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "yaml formatting differs", issues[0].Details())
+		assert.Equal(t, 4, issues[0].Position().Line)
+		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
+		assert.Equal(t, "`\n\t\t# comment\n\t\ta: 1\n\t\tb:\n\t\t  - x\n\t\t---\n\t\tc:\n\t\t  d: 1\n\t\t`",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("yaml directive keeps the quotes on strings that would otherwise be read as another type", func(t *testing.T) {
+		value, err := formatYaml("a: 'yes'\nb: 'off'\nc: 'y'\nd: 'null'\ne: \"1\"\nf: '1:30'\ng: 'x'\nh: \"two\n  lines\"\n",
+			DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "a: 'yes'\nb: 'off'\nc: 'y'\nd: 'null'\ne: \"1\"\nf: '1:30'\ng: x\nh: two lines\n", value)
+	})
+
+	t.Run("yaml directive keeps a leading document separator", func(t *testing.T) {
+		value, err := formatYaml("# comment\n---\na:   1\n---\nb: 2\n", DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "---\n# comment\na: 1\n---\nb: 2\n", value)
+
+		value, err = formatYaml("a: 1\n", DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "a: 1\n", value)
+	})
+
+	t.Run("yaml directive accepts yaml that is already indented", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:yaml
+				const yaml = `+"`\n\t\tkind: Pod\n\t\tmetadata:\n\t\t  name: example\n\t\t`"))
+		require.NoError(t, err)
+		assert.Len(t, issues, 0)
+	})
+
+	t.Run("yaml directive for invalid yaml generates an error", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:yaml
+				const yaml = `+"`a: [1`"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, `failed directive "yaml": yaml is not valid: yaml: line 1: did not find expected ',' or ']'`,
+			issues[0].Details())
+		assert.Equal(t, 3, issues[0].Position().Line)
+	})
+
+	t.Run("registered formatters are used for their directive", func(t *testing.T) {
+		fmtr := NewFormatter()
+		fmtr.Register("upper", StringFormatterFunc(func(value string, _ DirectiveOptions) (string, error) {
+			return strings.ToUpper(value), nil
+		}))
+		issues, err := fmtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:upper
+				const value = "abc"
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "upper formatting differs", issues[0].Details())
+		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
+		assert.Equal(t, `"ABC"`, issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("registered formatters are applied by FormatFile", func(t *testing.T) {
+		fmtr := NewFormatter()
+		fmtr.Register("upper", StringFormatterFunc(func(value string, _ DirectiveOptions) (string, error) {
+			return strings.ToUpper(value), nil
+		}))
+		src, fset, file := makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:upper
+				const value = "abc"
+				`)
+		_, err := fmtr.FormatFile(src, fset, file)
+		require.NoError(t, err)
+		buf := new(bytes.Buffer)
+		require.NoError(t, format.Node(buf, fset, file))
+		assert.Contains(t, buf.String(), `const value = "ABC"`)
+	})
+
+	t.Run("registered formatters receive the options they accept", func(t *testing.T) {
+		fmtr := NewFormatter()
+		fmtr.Register("repeat", StringFormatterFunc(func(value string, opts DirectiveOptions) (string, error) {
+			n, err := opts.Int("times", 1)
+			return strings.Repeat(value, n), err
+		}), "times")
+		issues, err := fmtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:repeat times=2
+				const value = "ab"
+				
+				//gofmts:repeat size=2
+				const other = "ab"
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 2)
+		assert.Equal(t, `"abab"`, issues[0].(IssueWithReplacement).Replacement())
+		assert.Equal(t, "unknown option \"size\" for directive `gofmts:repeat`", issues[1].Details())
+	})
+
+	t.Run("json options change the formatting", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:json indent=4 sort-keys // trailing comment
+				const json = `+"`{\"b\": 1, \"a\": 2}`"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
+		assert.Equal(t, "`\n\t\t{\n\t\t    \"a\": 2,\n\t\t    \"b\": 1\n\t\t}\n\t\t`",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("compact json stays on one line", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:json compact
+				const json = `+"`{\"a\":   [1,  2]}`"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
+		assert.Equal(t, "`{\"a\":[1,2]}`", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("sql keywords can be lower case", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:sql case=lower
+				const sql = `+"`SELECT * FROM mytable`"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
+		assert.Equal(t, "`\n\t\tselect\n\t\t  *\n\t\tfrom\n\t\t  mytable\n\t\t`",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("an unknown option generates an error", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:go indent=4
+				const expr = "1  + 2"`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "unknown option \"indent\" for directive `gofmts:go`", issues[0].Details())
+		assert.Equal(t, 3, issues[0].Position().Line)
+	})
+
+	t.Run("an invalid option value generates an error", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:json indent=wide
+				const json = "[1]"`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, `failed directive "json": option "indent" must be an integer`, issues[0].Details())
+	})
+
+	t.Run("mysql directive formats mysql", func(t *testing.T) {
+		issues, err := fmtr.Run(makeInputs(t,
+			`package main
+
+				//gofmts:mysql
+				const sql = `+"`select id from t limit 1, 2`"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "mysql formatting differs", issues[0].Details())
+		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
+		assert.Equal(t, "`\n\t\tSELECT\n\t\t  id\n\t\tFROM\n\t\t  t\n\t\tLIMIT 1, 2\n\t\t`",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
 }
@@ -2,7 +2,7 @@
 // Copyright 2015 The Go Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE fil
-package main
+package gofmts
 
 import (
 	"bytes"
@@ -15,13 +15,17 @@ import (
 
 // parse parses src, which was read from the named file,
 // as a Go source file, declaration, or statement list.
-func parse(fset *token.FileSet, filename string, src []byte, fragmentOk bool) (
+// The source that was parsed, which includes any wrapping
+// added to a fragment, is returned as parsedSrc.
+func parse(fset *token.FileSet, filename string, src []byte, fragmentOk bool, parserMode parser.Mode) (
 	file *ast.File,
+	parsedSrc []byte,
 	sourceAdj func(src []byte, indent int) []byte,
 	indentAdj int,
 	err error,
 ) {
 	// Try as whole source file.
+	parsedSrc = src
 	file, err = parser.ParseFile(fset, filename, src, parserMode)
 	// If there's no error, return. If the error is that the source file didn't begin with a
 	// package line and source fragments are ok, fall through to
@@ -37,6 +41,7 @@ func parse(fset *token.FileSet, filename string, src []byte, fragmentOk bool) (
 	psrc := append([]byte("package p;"), src...)
 	file, err = parser.ParseFile(fset, filename, psrc, parserMode)
 	if err == nil {
+		parsedSrc = psrc
 		sourceAdj = func(src []byte, indent int) []byte {
 			// Remove the package clause.
 			// Gofmt has turned the ';' into a '\n'.
@@ -61,6 +66,7 @@ func parse(fset *token.FileSet, filename string, src []byte, fragmentOk bool) (
 	fsrc := append(append([]byte("package p; func _() {"), src...), '\n', '\n', '}')
 	file, err = parser.ParseFile(fset, filename, fsrc, parserMode)
 	if err == nil {
+		parsedSrc = fsrc
 		sourceAdj = func(src []byte, indent int) []byte {
 			// Cap adjusted indent to zero.
 			if indent < 0 {
@@ -83,10 +89,10 @@ func parse(fset *token.FileSet, filename string, src []byte, fragmentOk bool) (
 	return
 }
 
-// format formats the given package file originally obtained from src
+// printFile formats the given package file originally obtained from src
 // and adjusts the result based on the original source via sourceAdj
 // and indentAdj.
-func format(
+func printFile(
 	fset *token.FileSet,
 	file *ast.File,
 	sourceAdj func(src []byte, indent int) []byte,
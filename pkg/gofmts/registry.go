@@ -0,0 +1,56 @@
+package gofmts
+
+// StringFormatter reformats the contents of a string literal that has been marked with a directive
+type StringFormatter interface {
+	Format(value string, opts DirectiveOptions) (string, error)
+}
+
+// StringFormatterFunc allows an ordinary function to be used as a StringFormatter
+type StringFormatterFunc func(value string, opts DirectiveOptions) (string, error)
+
+func (f StringFormatterFunc) Format(value string, opts DirectiveOptions) (string, error) {
+	return f(value, opts)
+}
+
+type registration struct {
+	formatter StringFormatter
+	options   map[string]bool
+}
+
+// Registry maps directive names to the formatters that handle them
+type Registry struct {
+	registrations map[string]registration
+}
+
+// NewRegistry returns a registry containing the built-in formatters
+func NewRegistry() *Registry {
+	r := &Registry{registrations: make(map[string]registration)}
+	r.Register("go", StringFormatterFunc(formatGo))
+	r.Register("json", StringFormatterFunc(formatJson), jsonOptions...)
+	r.Register("mysql", sqlFormatter{dialect: mysqlDialect}, sqlOptions...)
+	r.Register("postgresql", sqlFormatter{dialect: postgresqlDialect}, sqlOptions...)
+	r.Register("sql", sqlFormatter{dialect: postgresqlDialect}, sqlOptions...)
+	r.Register("sqlite", sqlFormatter{dialect: sqliteDialect}, sqlOptions...)
+	r.Register("yaml", StringFormatterFunc(formatYaml), yamlOptions...)
+	return r
+}
+
+// Register adds a formatter for the directive `//gofmts:<name>`, replacing any existing formatter with that name.
+// "options" lists the directive options the formatter accepts; any others are reported as unknown.
+func (r *Registry) Register(name string, f StringFormatter, options ...string) {
+	reg := registration{formatter: f, options: make(map[string]bool)}
+	for _, o := range options {
+		reg.options[o] = true
+	}
+	r.registrations[name] = reg
+}
+
+// Lookup returns the formatter registered for a directive name
+func (r *Registry) Lookup(name string) (StringFormatter, bool) {
+	reg, ok := r.registrations[name]
+	return reg.formatter, ok
+}
+
+func (r *Registry) acceptsOption(name, option string) bool {
+	return r.registrations[name].options[option]
+}
@@ -3,8 +3,10 @@ package gofmts
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"go/ast"
 	"go/format"
+	"go/parser"
 	"go/printer"
 	"go/token"
 	"math/big"
@@ -18,10 +20,7 @@ import (
 )
 
 func SortFile(fset *token.FileSet, file *ast.File) ([]Issue, error) {
-	srtr := NewSorter()
-	srtr.applyReplacements = true
-	srtr.skipReplacementText = true
-	return srtr.Run(fset, file)
+	return NewSorter().SortFile(fset, file)
 }
 
 func NewSorter() *Sorter {
@@ -31,6 +30,15 @@ func NewSorter() *Sorter {
 type Sorter struct {
 	skipReplacementText bool // don't generate the replacement strings
 	applyReplacements   bool // apply replacements to input file
+	disabled            bool // ignore sort directives
+}
+
+// SortFile calculates the issues and applies the replacements to "file"
+func (s *Sorter) SortFile(fset *token.FileSet, file *ast.File) ([]Issue, error) {
+	srtr := *s
+	srtr.applyReplacements = true
+	srtr.skipReplacementText = true
+	return srtr.Run(fset, file)
 }
 
 type SortIssue struct {
@@ -39,6 +47,14 @@ type SortIssue struct {
 	position    token.Position
 	end         token.Position
 	replacement string
+	sorted      sortedBlock // where the block is in the sorted tree
+}
+
+// sortedBlock locates a sorted block in the tree by the nodes at its start and end.  The block starts with the
+// comments before its first node that moved with that node, if any.
+type sortedBlock struct {
+	first, last dst.Node
+	comments    int
 }
 
 func (i SortIssue) Details() string {
@@ -57,13 +73,65 @@ func (i SortIssue) Length() int {
 	return i.end.Offset - i.position.Offset
 }
 
+func (i SortIssue) End() token.Position {
+	return i.end
+}
+
+func (i SortIssue) Directive() string { return i.directive }
+
 func (i SortIssue) String() string { return toString(i) }
 
 func (i SortIssue) Replacement() string { return i.replacement }
 
+// DuplicateEntryIssue is an entry of a block sorted with the unique option whose key is the same as that of an earlier
+// entry
+type DuplicateEntryIssue struct {
+	directive string
+	key       string
+	pos       token.Pos
+	position  token.Position
+	first     token.Position
+}
+
+func (i DuplicateEntryIssue) Details() string {
+	return fmt.Sprintf("duplicate entry %s (first on line %d)", i.key, i.first.Line)
+}
+
+func (i DuplicateEntryIssue) Pos() token.Pos {
+	return i.pos
+}
+
+func (i DuplicateEntryIssue) Position() token.Position {
+	return i.position
+}
+
+func (i DuplicateEntryIssue) Directive() string { return i.directive }
+
+func (i DuplicateEntryIssue) String() string { return toString(i) }
+
+// ExactDuplicateIssue is a DuplicateEntryIssue for an entry that is the same as the earlier one, without any comments
+// of its own, so it can be fixed by removing the lines of the entry
+type ExactDuplicateIssue struct {
+	DuplicateEntryIssue
+	end token.Position
+}
+
+func (i ExactDuplicateIssue) Length() int {
+	return i.end.Offset - i.position.Offset
+}
+
+func (i ExactDuplicateIssue) End() token.Position {
+	return i.end
+}
+
+func (i ExactDuplicateIssue) String() string { return toString(i) }
+
+func (i ExactDuplicateIssue) Replacement() string { return "" }
+
 type sortGroup struct {
 	directive    string
 	directivePos token.Pos
+	order        *sortOrder // how to order the nodes, or nil if the directive is invalid
 	nodes        []dst.Node
 }
 
@@ -79,138 +147,440 @@ func (g *sortGroup) startPos(dcrtr *decorator.Decorator) token.Pos {
 }
 
 type sortVisitor struct {
+	file            *dst.File
 	decorator       *decorator.Decorator
-	directivesByPos map[token.Pos]string
+	directives      *directiveIndex
 	sortGroups      []*sortGroup
 	fset            *token.FileSet
 	activeSortGroup *sortGroup
+	issues          []Issue
 }
 
+// sortOptions are the options accepted by the sort directive
+var sortOptions = []string{"by", "case-insensitive", "decls", "elements", "natural", "reverse", "semver", "unique"}
+
+// sortCriteria are the parts of a node that a block can be sorted by, of which the first is the default
+var sortCriteria = []string{"key", "value", "type"}
+
 func (s *Sorter) Run(fset *token.FileSet, files ...*ast.File) (issues []Issue, _ error) {
 	for _, file := range files {
-		directivesByPos := make(map[token.Pos]string) // nolint:prealloc // don't know how many there will be
-		for _, group := range file.Comments {
-			for _, comment := range group.List {
-				if comment.Text[1] == '*' { // only allow directives on //-style comments
-					continue
-				}
+		d, err := decorateFile(fset, file)
+		if err != nil {
+			return nil, err
+		}
+		fileIssues, changed := s.run(d)
+		if changed && (s.applyReplacements || !s.skipReplacementText) {
+			restorer, af, err := d.restore()
+			if err != nil {
+				return nil, err
+			}
 
-				if strings.HasPrefix(comment.Text[2:], directivePrefix+"sort") {
-					directivesByPos[comment.End()] = "sort"
+			if s.applyReplacements {
+				*file = *af
+			}
+
+			if !s.skipReplacementText {
+				buf := new(bytes.Buffer)
+				err := format.Node(buf, restorer.Fset, af)
+				if err != nil {
+					return nil, errors.Wrap(err, "dst restore failed")
+				}
+				printedFset := token.NewFileSet()
+				printed, err := parser.ParseFile(printedFset, "", buf.Bytes(), parser.ParseComments)
+				if err != nil {
+					return nil, errors.Wrap(err, "unable to parse sorted source")
+				}
+				if err := setSortReplacements(fileIssues, restorer, af, buf.Bytes(), printedFset, printed); err != nil {
+					return nil, err
 				}
 			}
 		}
-		dcrtr := decorator.NewDecorator(fset)
-		pos := func(n dst.Node) token.Pos {
-			return dcrtr.Ast.Nodes[n].Pos()
+		issues = append(issues, fileIssues...)
+	}
+	return issues, nil
+}
+
+// run finds the unsorted blocks in a decorated file and sorts them in its tree, reporting whether there were any
+func (s *Sorter) run(d *decoratedFile) (issues []Issue, changed bool) {
+	if s.disabled {
+		return nil, false
+	}
+	directivesByPos := make(map[token.Pos]directive) // nolint:prealloc // don't know how many there will be
+	for _, group := range d.ast.Comments {
+		for _, comment := range group.List {
+			if comment.Text[1] == '*' { // only allow directives on //-style comments
+				continue
+			}
+
+			if matches := directivePattern.FindStringSubmatch(comment.Text); matches != nil && matches[1] == "sort" {
+				directivesByPos[comment.End()] = parseDirective(matches[1], matches[2])
+			}
+		}
+	}
+	fset, dcrtr := d.fset, d.decorator
+	pos := func(n dst.Node) token.Pos {
+		return dcrtr.Ast.Nodes[n].Pos()
+	}
+	visitor := &sortVisitor{
+		file:       d.dst,
+		decorator:  dcrtr,
+		directives: newDirectiveIndex(fset, directivesByPos),
+		fset:       fset,
+	}
+	dst.Walk(visitor, d.dst)
+
+	replacementNodes := make(map[dst.Node]dst.Node)
+	removedNodes := make(map[dst.Node]bool)
+	listsSorted := false
+	declsMoved := false
+	var movedDecls [][2]token.Pos // the spans of the declarations that have been sorted
+
+	issues = append(issues, visitor.issues...)
+
+	// create issues from the sort groups
+	for _, g := range visitor.sortGroups {
+		if g.order == nil {
+			continue // the directive has already been reported
+		}
+		if _, ok := g.nodes[0].(*dst.CaseClause); ok && fallsThrough(d.dst, g.nodes[0]) {
+			issues = append(issues, FailedDirective{directive: g.directive, pos: g.directivePos,
+				position: fset.Position(g.directivePos), error: errors.New("cases of a switch with fallthrough can't be sorted")})
+			continue
 		}
-		visitor := &sortVisitor{
-			decorator:       dcrtr,
-			directivesByPos: directivesByPos,
-			fset:            fset,
+		caseListsSorted := sortCaseLists(g.nodes, *g.order, fset, dcrtr)
+		listsSorted = listsSorted || caseListsSorted
+
+		nodes := g.nodes
+		if g.order.unique {
+			var removed []dst.Node
+			var duplicateIssues []Issue
+			nodes, removed, duplicateIssues = newSortNodes(g.nodes, *g.order, fset, dcrtr).removeDuplicates(g.directive)
+			issues = append(issues, duplicateIssues...)
+			for _, node := range removed {
+				removedNodes[node] = true
+			}
+			if last := g.nodes[len(g.nodes)-1]; removedNodes[last] {
+				// keep the space after the group
+				nodes[len(nodes)-1].Decorations().After = last.Decorations().After
+			}
 		}
-		dstFile, err := dcrtr.DecorateFile(file)
-		if err != nil {
-			return nil, errors.Wrapf(err, "decorate failed")
-		}
-		dst.Walk(visitor, dstFile)
-
-		replacementNodes := make(map[dst.Node]dst.Node)
-
-		// create issues from the sort groups
-		for _, g := range visitor.sortGroups {
-			sortedNodes := make([]dst.Node, len(g.nodes))
-			copy(sortedNodes, g.nodes)
-			sort.Sort(sortNodes{nodes: sortedNodes, fset: fset, decorator: dcrtr})
-			unsorted := false
-			for dstIndex, orig := range g.nodes {
-				// if we've moved this node
-				if pos(orig) != pos(sortedNodes[dstIndex]) {
-					// clone the node taking this spot
-					repl := dst.Clone(sortedNodes[dstIndex])
-
-					// don't carry any extra spaces with this node
-					if repl.Decorations().After == dst.EmptyLine {
-						repl.Decorations().After = dst.NewLine
-					}
-
-					if repl.Decorations().Before == dst.EmptyLine {
-						repl.Decorations().Before = dst.NewLine
-					}
-
-					switch dstIndex {
-					case 0:
-						// move the "preamble" (including the sort directive) to the new start
-						preamble := orig.Decorations().Start.All()
-						orig.Decorations().Start.Clear()
-						repl.Decorations().Start.Prepend(preamble...)
-						repl.Decorations().Before = orig.Decorations().Before
-					case len(g.nodes) - 1:
-						// make sure we retain a space after the group if we change the last node
-						repl.Decorations().After = orig.Decorations().After
-					}
+		sortedNodes := newSortNodes(nodes, *g.order, fset, dcrtr)
+		sort.Stable(sortedNodes)
+		unsorted := false
+		firstComments := 0 // the comments that move to the start of the block with a new first node
+		for dstIndex, orig := range nodes {
+			// if we've moved this node
+			if pos(orig) != pos(sortedNodes.nodes[dstIndex]) {
+				unsorted = true
+				if g.order.decls {
+					continue // the declarations are moved together below
+				}
 
+				// clone the node taking this spot
+				repl := dst.Clone(sortedNodes.nodes[dstIndex])
+
+				if g.order.elements {
+					// the literal keeps its shape, so each element takes the spacing of the one it replaces
+					repl.Decorations().Before = orig.Decorations().Before
+					repl.Decorations().After = orig.Decorations().After
 					replacementNodes[orig] = repl
-					unsorted = true
+					continue
 				}
+
+				// don't carry any extra spaces with this node
+				if repl.Decorations().After == dst.EmptyLine {
+					repl.Decorations().After = dst.NewLine
+				}
+
+				if repl.Decorations().Before == dst.EmptyLine {
+					repl.Decorations().Before = dst.NewLine
+				}
+
+				switch dstIndex {
+				case 0:
+					// move the "preamble" (including the sort directive) to the new start
+					firstComments = countComments(repl.Decorations().Start)
+					preamble := orig.Decorations().Start.All()
+					orig.Decorations().Start.Clear()
+					repl.Decorations().Start.Prepend(preamble...)
+					repl.Decorations().Before = orig.Decorations().Before
+				case len(nodes) - 1:
+					// make sure we retain a space after the group if we change the last node
+					repl.Decorations().After = orig.Decorations().After
+				}
+
+				replacementNodes[orig] = repl
 			}
-			if !unsorted {
-				continue // no changes
-			}
-			startPos := g.startPos(dcrtr)
-			issue := SortIssue{
-				directive: g.directive,
-				pos:       startPos,
-				position:  fset.Position(startPos),
-				end:       fset.Position(g.endPos(dcrtr)),
+		}
+		if !unsorted && !caseListsSorted {
+			continue // no changes
+		}
+		// the block starts with its first node, or with the comments before it that move along with it
+		block := sortedBlock{first: nodes[0], last: nodes[len(nodes)-1], comments: firstComments}
+		if repl := replacementNodes[block.first]; repl != nil {
+			block.first = repl
+		}
+		if repl := replacementNodes[block.last]; repl != nil {
+			block.last = repl
+		}
+		srcComments := 0
+		switch {
+		case g.order.elements:
+			srcComments = countComments(nodes[0].Decorations().Start)
+			block.comments = countComments(block.first.Decorations().Start)
+		case g.order.decls:
+			// the doc comments after the directive move with their declarations
+			preambleEnd := directiveEnd(nodes[0].Decorations().Start)
+			srcComments = countComments(nodes[0].Decorations().Start[preambleEnd:])
+			moveDecls(d.dst, nodes, sortedNodes.nodes)
+			declsMoved = true
+			block.first, block.last = sortedNodes.nodes[0], sortedNodes.nodes[len(nodes)-1]
+			block.comments = countComments(block.first.Decorations().Start[preambleEnd:])
+		}
+		start := commentsStart(d.ast.Comments, g.startPos(dcrtr), srcComments)
+		if within(movedDecls, start) {
+			continue // the block is sorted along with the declarations that hold it
+		}
+		// the replacement is made of whole lines, so the issue spans them too
+		startPos, endPos := lineSpan(fset, start, g.endPos(dcrtr))
+		issue := SortIssue{
+			directive: g.directive,
+			pos:       startPos,
+			position:  fset.Position(startPos),
+			end:       fset.Position(endPos),
+			sorted:    block,
+		}
+		if g.order.decls {
+			movedDecls = append(movedDecls, [2]token.Pos{startPos, endPos})
+		}
+		issues = append(issues, issue)
+	}
+
+	changed = len(replacementNodes) > 0 || len(removedNodes) > 0 || listsSorted || declsMoved
+
+	for _, dir := range visitor.directives.remaining() {
+		issues = append(issues, UnusedDirective{name: "sort", pos: dir.pos, position: fset.Position(dir.pos)})
+	}
+
+	if changed {
+		dstutil.Apply(d.dst, nil, func(cursor *dstutil.Cursor) bool {
+			if cursor.Node() == nil {
+				return true
+			} else if removedNodes[cursor.Node()] && cursor.Index() >= 0 {
+				cursor.Delete()
+			} else if repl := replacementNodes[cursor.Node()]; repl != nil {
+				cursor.Replace(repl)
 			}
-			issues = append(issues, issue)
+			return true
+		})
+	}
+	return issues, changed
+}
+
+// moveDecls puts the top-level declarations in "slots" in the order of "sorted".  Unlike other nodes, declarations are
+// moved rather than copied, so that blocks sorted inside them stay sorted.  Each declaration takes its doc comment and
+// the empty lines around it with it, but the spacing before and after the group, and the sort directive, stay where
+// they are.
+func moveDecls(file *dst.File, slots, sorted []dst.Node) {
+	index := make(map[dst.Node]int, len(file.Decls))
+	for i, decl := range file.Decls {
+		index[decl] = i
+	}
+	first, last := slots[0].Decorations(), slots[len(slots)-1].Decorations()
+	before, after := first.Before, last.After
+
+	// the preamble of the first declaration ends with the directive
+	preambleEnd := directiveEnd(first.Start)
+	preamble := append([]string(nil), first.Start[:preambleEnd]...)
+	first.Start.Replace(first.Start[preambleEnd:]...)
+
+	// the declarations that leave the ends of the group take the spacing on their inner side to both sides
+	first.Before, last.After = first.After, last.Before
+	for i, slot := range slots {
+		file.Decls[index[slot]] = sorted[i].(dst.Decl)
+	}
+	sorted[0].Decorations().Before = before
+	sorted[len(sorted)-1].Decorations().After = after
+	sorted[0].Decorations().Start.Prepend(preamble...)
+}
+
+// directiveEnd returns the index of the decoration after the last sort directive in "decs", or 0 if there isn't one
+func directiveEnd(decs dst.Decorations) int {
+	end := 0
+	for i, dec := range decs {
+		if matches := directivePattern.FindStringSubmatch(dec); matches != nil && matches[1] == "sort" {
+			end = i + 1
 		}
+	}
+	return end
+}
 
-		hasChanges := len(issues) > 0
+// countComments returns the number of comments in "decs", which may also hold the empty lines between them
+func countComments(decs dst.Decorations) int {
+	n := 0
+	for _, dec := range decs {
+		if strings.HasPrefix(dec, "//") || strings.HasPrefix(dec, "/*") {
+			n++
+		}
+	}
+	return n
+}
 
-		for pos := range directivesByPos {
-			issues = append(issues, UnusedDirective{name: "sort", position: fset.Position(pos)})
+// commentsStart returns the start of the last "n" comments before "pos", or "pos" itself if "n" is zero.  "groups" are
+// sorted by position, as in ast.File.Comments.
+func commentsStart(groups []*ast.CommentGroup, pos token.Pos, n int) token.Pos {
+	if n == 0 {
+		return pos
+	}
+	// only the groups that start before "pos" may hold comments before it
+	i := sort.Search(len(groups), func(i int) bool { return groups[i].Pos() >= pos })
+	start := pos
+	for ; i > 0 && n > 0; i-- {
+		list := groups[i-1].List
+		for j := len(list) - 1; j >= 0 && n > 0; j-- {
+			if list[j].End() <= pos {
+				start = list[j].Pos()
+				n--
+			}
 		}
+	}
+	if n > 0 {
+		return pos
+	}
+	return start
+}
 
-		if hasChanges && (s.applyReplacements || !s.skipReplacementText) {
-			dstutil.Apply(dstFile, nil, func(cursor *dstutil.Cursor) bool {
-				if cursor.Node() == nil {
-					return true
-				} else if repl := replacementNodes[cursor.Node()]; repl != nil {
-					cursor.Replace(repl)
+// fallsThrough reports whether any case of the switch holding "clause" falls through to the next, so that the cases
+// can't be moved
+func fallsThrough(file *dst.File, clause dst.Node) bool {
+	var clauses []dst.Stmt
+	dst.Inspect(file, func(n dst.Node) bool {
+		if block, ok := n.(*dst.BlockStmt); ok {
+			for _, stmt := range block.List {
+				if stmt == clause {
+					clauses = block.List
 				}
+			}
+		}
+		return clauses == nil
+	})
+	for _, stmt := range clauses {
+		if cc, ok := stmt.(*dst.CaseClause); ok && len(cc.Body) > 0 {
+			if branch, ok := cc.Body[len(cc.Body)-1].(*dst.BranchStmt); ok && branch.Tok == token.FALLTHROUGH {
 				return true
-			})
-
-			restorer := decorator.NewRestorer()
-			restorer.Fset = dcrtr.Fset
-			af, err := restorer.RestoreFile(dstFile)
-			if err != nil {
-				return nil, errors.Wrap(err, "dst restore failed")
 			}
+		}
+	}
+	return false
+}
 
-			if s.applyReplacements {
-				*file = *af
+// sortCaseLists sorts the expressions of the case clauses among "nodes" that have more than one, reporting whether
+// any were unsorted.  The expressions take the spacing of those they replace.
+func sortCaseLists(nodes []dst.Node, order sortOrder, fset *token.FileSet, dcrtr *decorator.Decorator) bool {
+	order.by = "key"
+	sorted := false
+	for _, node := range nodes {
+		cc, ok := node.(*dst.CaseClause)
+		if !ok || len(cc.List) < 2 {
+			continue
+		}
+		exprs := make([]dst.Node, len(cc.List))
+		for i, expr := range cc.List {
+			exprs[i] = expr
+		}
+		sortedExprs := newSortNodes(exprs, order, fset, dcrtr)
+		sort.Stable(sortedExprs)
+		moved := false
+		for i, expr := range cc.List {
+			if sortedExprs.nodes[i] != expr {
+				moved = true
 			}
+		}
+		if !moved {
+			continue
+		}
+		sorted = true
+		spacing := make([]dst.NodeDecs, len(cc.List))
+		for i, expr := range cc.List {
+			spacing[i] = *expr.Decorations()
+		}
+		for i := range cc.List {
+			expr := sortedExprs.nodes[i].(dst.Expr)
+			expr.Decorations().Before, expr.Decorations().After = spacing[i].Before, spacing[i].After
+			cc.List[i] = expr
+		}
+	}
+	return sorted
+}
 
-			if !s.skipReplacementText {
-				buf := new(bytes.Buffer)
-				err := format.Node(buf, restorer.Fset, af)
-				if err != nil {
-					return nil, errors.Wrap(err, "dst restore failed")
-				}
-				lines := readLines(buf)
-				for i, issue := range issues {
-					if s, ok := issue.(SortIssue); ok {
-						s.replacement = strings.Join(lines[s.position.Line-1:s.end.Line], "")
-						issues[i] = s
-					}
-				}
+// setSortReplacements sets the replacements of the sort issues to the lines their blocks span in "printed", which is
+// "restored" as printed.  Since the printer may change the number of lines anywhere in the file, such as by removing
+// empty lines, the blocks are found by parsing the printed source again and matching its nodes with those of the tree.
+func setSortReplacements(issues []Issue, restorer *decorator.Restorer, restored *ast.File, printed []byte,
+	printedFset *token.FileSet, printedFile *ast.File) error {
+	printedNodes := matchNodes(restored, printedFile)
+	lines := readLines(bytes.NewBuffer(printed))
+	for i, issue := range issues {
+		s, ok := issue.(SortIssue)
+		if !ok {
+			continue
+		}
+		first, last := printedNodes[restorer.Ast.Nodes[s.sorted.first]], printedNodes[restorer.Ast.Nodes[s.sorted.last]]
+		if first == nil || last == nil {
+			return errors.Errorf("unable to find the sorted block at %s", s.position)
+		}
+		start := printedFset.Position(commentsStart(printedFile.Comments, first.Pos(), s.sorted.comments)).Line
+		end := printedFset.Position(last.End()).Line
+		s.replacement = strings.Join(lines[start-1:end], "")
+		issues[i] = s
+	}
+	return nil
+}
+
+// matchNodes pairs the nodes of "file" with those of "printed", which is "file" printed and parsed again, so that both
+// have the same nodes in the same order.  Comments are left out, since the parser may attach them differently.
+func matchNodes(file, printed *ast.File) map[ast.Node]ast.Node {
+	var nodes, printedNodes []ast.Node
+	collect := func(nodes *[]ast.Node) func(ast.Node) bool {
+		return func(n ast.Node) bool {
+			switch n.(type) {
+			case nil, *ast.CommentGroup:
+				return false
 			}
+			*nodes = append(*nodes, n)
+			return true
 		}
 	}
-	return issues, nil
+	ast.Inspect(file, collect(&nodes))
+	ast.Inspect(printed, collect(&printedNodes))
+	matches := make(map[ast.Node]ast.Node, len(nodes))
+	if len(nodes) != len(printedNodes) {
+		return matches
+	}
+	for i, n := range nodes {
+		matches[n] = printedNodes[i]
+	}
+	return matches
+}
+
+// within reports whether "pos" is in any of "spans"
+func within(spans [][2]token.Pos, pos token.Pos) bool {
+	for _, span := range spans {
+		if span[0] <= pos && pos < span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// lineSpan extends a span to the start of its first line and past the newline ending its last line
+func lineSpan(fset *token.FileSet, start, end token.Pos) (token.Pos, token.Pos) {
+	file := fset.File(start)
+	start = file.LineStart(file.Line(start))
+	if line := file.Line(end); line < file.LineCount() {
+		return start, file.LineStart(line + 1)
+	}
+	return start, token.Pos(file.Base() + file.Size())
 }
 
 func readLines(fbuf *bytes.Buffer) []string {
@@ -228,7 +598,7 @@ func (v *sortVisitor) Visit(node dst.Node) dst.Visitor {
 	}
 
 	if v.activeSortGroup == nil {
-		directivePos, directive := findClosestDirective(v.fset, v.directivesByPos, v.decorator.Ast.Nodes[node], true)
+		directivePos, d := findClosestDirective(v.fset, v.directives, v.decorator.Ast.Nodes[node], true)
 		if directivePos == token.NoPos {
 			return v // couldn't find a directive, so look in children
 		}
@@ -240,22 +610,33 @@ func (v *sortVisitor) Visit(node dst.Node) dst.Visitor {
 			return v // couldn't find a directive, so look in children
 		}
 
+		order := v.sortOrder(d, directivePos)
+		v.directives.consume(directivePos)
+		if order != nil && order.elements {
+			v.addElementsGroup(d.name, directivePos, order, node)
+			return nil // the elements of the literal are the whole group
+		}
+		if order != nil && order.decls {
+			v.addDeclsGroup(d.name, directivePos, order, node)
+			return v // the declarations may have blocks of their own to sort
+		}
+
 		v.activeSortGroup = &sortGroup{
-			directive:    directive,
+			directive:    d.name,
 			directivePos: directivePos,
+			order:        order,
 			nodes:        []dst.Node{node},
 		}
 		v.sortGroups = append(v.sortGroups, v.activeSortGroup)
-		delete(v.directivesByPos, directivePos)
 		return nil // skip children now that we have a sort group
 	}
 
 	groupEndLine := v.fset.Position(v.activeSortGroup.endPos(v.decorator)).Line
 
-	// node is not part of group, so close the old group
+	// node is not part of group, so close the old group and see whether the node starts a new one
 	if node.Decorations().Before == dst.EmptyLine || v.calculateNodeStartLine(node) > groupEndLine+1 {
 		v.activeSortGroup = nil
-		return v // walk children
+		return v.Visit(node)
 	}
 
 	v.activeSortGroup.nodes = append(v.activeSortGroup.nodes, node)
@@ -268,6 +649,85 @@ func (v *sortVisitor) Visit(node dst.Node) dst.Visitor {
 	return nil // skip children since this node and its children are in current group
 }
 
+// addElementsGroup adds a group of the elements of the first composite literal in "node", however they are laid out
+func (v *sortVisitor) addElementsGroup(name string, directivePos token.Pos, order *sortOrder, node dst.Node) {
+	var lit *dst.CompositeLit
+	dst.Inspect(node, func(n dst.Node) bool {
+		if l, ok := n.(*dst.CompositeLit); ok && lit == nil {
+			lit = l
+		}
+		return lit == nil
+	})
+	if lit == nil {
+		v.issues = append(v.issues, FailedDirective{directive: name, pos: directivePos, position: v.fset.Position(directivePos),
+			error: errors.New(`option "elements" must be followed by a composite literal`)})
+		return
+	}
+	if len(lit.Elts) == 0 {
+		return
+	}
+	g := &sortGroup{directive: name, directivePos: directivePos, order: order}
+	for _, elt := range lit.Elts {
+		g.nodes = append(g.nodes, elt)
+	}
+	v.sortGroups = append(v.sortGroups, g)
+}
+
+// addDeclsGroup adds a group of the function declaration "node" and those that follow it, whether or not they are
+// separated by empty lines, up to the next declaration that isn't a function
+func (v *sortVisitor) addDeclsGroup(name string, directivePos token.Pos, order *sortOrder, node dst.Node) {
+	g := &sortGroup{directive: name, directivePos: directivePos, order: order}
+	for i, decl := range v.file.Decls {
+		if decl != node {
+			continue
+		}
+		for _, decl := range v.file.Decls[i:] {
+			if _, ok := decl.(*dst.FuncDecl); !ok {
+				break
+			}
+			g.nodes = append(g.nodes, decl)
+		}
+	}
+	if len(g.nodes) == 0 {
+		v.issues = append(v.issues, FailedDirective{directive: name, pos: directivePos, position: v.fset.Position(directivePos),
+			error: errors.New(`option "decls" must be followed by a function`)})
+		return
+	}
+	v.sortGroups = append(v.sortGroups, g)
+}
+
+// sortOrder returns how a directive orders its block, or reports the problems with its options and returns nil
+func (v *sortVisitor) sortOrder(d directive, pos token.Pos) *sortOrder {
+	var unknown []string
+	for name := range d.options {
+		if !stringsContain(sortOptions, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		v.issues = append(v.issues, UnknownOption{directive: d.name, option: name, pos: pos, position: v.fset.Position(pos)})
+	}
+	if len(unknown) > 0 {
+		return nil
+	}
+	order, err := parseSortOrder(d.options)
+	if err != nil {
+		v.issues = append(v.issues, FailedDirective{directive: d.name, pos: pos, position: v.fset.Position(pos), error: err})
+		return nil
+	}
+	return order
+}
+
+func stringsContain(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (v *sortVisitor) calculateNodeStartLine(node dst.Node) int {
 	astNode := v.decorator.Ast.Nodes[node]
 	nodeStartLine := v.fset.Position(astNode.Pos()).Line
@@ -288,36 +748,271 @@ func (v *sortVisitor) calculateNodeStartLine(node dst.Node) int {
 
 type sortNodes struct {
 	nodes     []dst.Node
+	keys      []sortKey
+	fallbacks []sortKey // keys to break ties between nodes sorted by something other than their key
+	order     sortOrder
 	fset      *token.FileSet
 	decorator *decorator.Decorator
 }
 
+func newSortNodes(nodes []dst.Node, order sortOrder, fset *token.FileSet, dcrtr *decorator.Decorator) sortNodes {
+	s := sortNodes{
+		nodes:     make([]dst.Node, len(nodes)),
+		keys:      make([]sortKey, len(nodes)),
+		order:     order,
+		fset:      fset,
+		decorator: dcrtr,
+	}
+	copy(s.nodes, nodes)
+	if order.by != "key" {
+		s.fallbacks = make([]sortKey, len(nodes))
+	}
+	for i, node := range nodes {
+		s.keys[i] = s.key(node, order.by)
+		if s.fallbacks != nil {
+			s.fallbacks[i] = s.key(node, "key")
+		}
+	}
+	return s
+}
+
+// removeDuplicates reports the nodes whose keys are the same as those of earlier nodes, returning the nodes to keep
+// and those to remove, which are exact duplicates
+func (s sortNodes) removeDuplicates(directive string) (kept, removed []dst.Node, issues []Issue) {
+	first := make(map[string]int)
+	for i, node := range s.nodes {
+		key := s.keys[i]
+		if s.order.by == "key" {
+			key = s.entryKey(node)
+		}
+		id := "text:" + key.text
+		if key.number != nil {
+			id = "number:" + key.number.Text('g', -1)
+		}
+		j, seen := first[id]
+		if !seen {
+			first[id] = i
+			kept = append(kept, node)
+			continue
+		}
+		astNode := s.decorator.Ast.Nodes[node]
+		issue := DuplicateEntryIssue{
+			directive: directive,
+			key:       key.text,
+			pos:       astNode.Pos(),
+			position:  s.fset.Position(astNode.Pos()),
+			first:     s.fset.Position(s.decorator.Ast.Nodes[s.nodes[j]].Pos()),
+		}
+		decs := node.Decorations()
+		if len(decs.Start) > 0 || len(decs.End) > 0 || s.renderEntry(node) != s.renderEntry(s.nodes[j]) {
+			kept = append(kept, node)
+			issues = append(issues, issue)
+			continue
+		}
+		startPos, endPos := lineSpan(s.fset, astNode.Pos(), astNode.End())
+		if prevEnd := s.decorator.Ast.Nodes[s.nodes[i-1]].End(); s.fset.Position(prevEnd).Line == issue.position.Line {
+			startPos, endPos = prevEnd, astNode.End() // remove the duplicate along with the comma before it
+		}
+		issue.pos, issue.position = startPos, s.fset.Position(startPos)
+		removed = append(removed, node)
+		issues = append(issues, ExactDuplicateIssue{DuplicateEntryIssue: issue, end: s.fset.Position(endPos)})
+	}
+	return kept, removed, issues
+}
+
+// entryKey returns the part of a node that names it, such as the key of a map entry or the names of a constant
+func (s sortNodes) entryKey(node dst.Node) sortKey {
+	var parts []ast.Node
+	switch n := s.decorator.Ast.Nodes[node].(type) {
+	case *ast.KeyValueExpr:
+		parts = []ast.Node{n.Key}
+	case *ast.ValueSpec:
+		for _, name := range n.Names {
+			parts = append(parts, name)
+		}
+	case *ast.TypeSpec:
+		parts = []ast.Node{n.Name}
+	case *ast.AssignStmt:
+		for _, lhs := range n.Lhs {
+			parts = append(parts, lhs)
+		}
+	default:
+		return s.key(node, "key")
+	}
+	texts := make([]string, len(parts))
+	for i, part := range parts {
+		texts[i] = s.render(part)
+	}
+	key := sortKey{text: strings.Join(texts, ", ")}
+	if len(parts) == 1 {
+		key.number = numberValue(parts[0])
+	}
+	return key
+}
+
 func (s sortNodes) Len() int {
 	return len(s.nodes)
 }
 
 func (s sortNodes) Less(a, b int) bool {
-	astNodeA := s.decorator.Ast.Nodes[s.nodes[a]]
-	switch astNodeA := astNodeA.(type) {
-	case *ast.BasicLit:
-		switch astNodeA.Kind {
-		case token.INT, token.FLOAT:
-			var fA, fB big.Float
-			_, _, _ = fA.SetPrec(1000).Parse(astNodeA.Value, 0)
-			astNodeB := s.decorator.Ast.Nodes[s.nodes[b]]
-			if astNodeB, bothAreNumbers := astNodeB.(*ast.BasicLit); !bothAreNumbers {
-				return false
-			} else {
-				_, _, _ = fB.SetPrec(1000).Parse(astNodeB.Value, 0)
-			}
-			return fA.Cmp(&fB) == -1
-		}
+	if s.keys[a].last != s.keys[b].last {
+		return s.keys[b].last // such as a default case, which stays last in either order
 	}
-	return s.renderNode(s.nodes[a]) < s.renderNode(s.nodes[b])
+	c := s.order.compare(s.keys[a], s.keys[b])
+	if c == 0 && s.fallbacks != nil {
+		c = s.order.compare(s.fallbacks[a], s.fallbacks[b])
+	}
+	if s.order.reverse {
+		return c > 0
+	}
+	return c < 0
 }
 
 func (s sortNodes) Swap(a, b int) {
 	s.nodes[a], s.nodes[b] = s.nodes[b], s.nodes[a]
+	s.keys[a], s.keys[b] = s.keys[b], s.keys[a]
+	if s.fallbacks != nil {
+		s.fallbacks[a], s.fallbacks[b] = s.fallbacks[b], s.fallbacks[a]
+	}
+}
+
+// sortKey is the text of the part of a node that it is sorted by and, if that part is a number, its value
+type sortKey struct {
+	text   string
+	number *big.Float
+	last   bool // the node goes after all the others
+}
+
+// key returns the key that a node is sorted by.  Nodes without a value or type, such as a constant whose value is
+// implied, have an empty key when sorted by value or type.
+func (s sortNodes) key(node dst.Node, by string) sortKey {
+	astNode := s.decorator.Ast.Nodes[node]
+	var parts []ast.Expr
+	switch by {
+	case "key":
+		if key, ok := s.caseKey(node); ok {
+			return key
+		}
+		if decl, ok := astNode.(*ast.FuncDecl); ok {
+			return sortKey{text: funcName(decl)}
+		}
+		return sortKey{text: s.renderNode(node), number: numberValue(astNode)}
+	case "value":
+		parts = nodeValues(astNode)
+	case "type":
+		if t := nodeType(astNode); t != nil {
+			parts = []ast.Expr{t}
+		}
+	}
+	texts := make([]string, len(parts))
+	for i, part := range parts {
+		texts[i] = s.render(part)
+	}
+	key := sortKey{text: strings.Join(texts, ", ")}
+	if len(parts) == 1 {
+		key.number = numberValue(parts[0])
+	}
+	return key
+}
+
+// caseKey returns the key of a case clause, which is its first expression or, for a select, its communication.  The
+// default case goes last.
+func (s sortNodes) caseKey(node dst.Node) (sortKey, bool) {
+	var first dst.Node
+	switch n := node.(type) {
+	case *dst.CaseClause:
+		if len(n.List) > 0 {
+			first = n.List[0] // the list may have been sorted, so the decorated node is more up to date
+		}
+	case *dst.CommClause:
+		if n.Comm != nil {
+			first = n.Comm
+		}
+	default:
+		return sortKey{}, false
+	}
+	if first == nil {
+		return sortKey{text: "default", last: true}, true
+	}
+	astNode := s.decorator.Ast.Nodes[first]
+	return sortKey{text: s.render(astNode), number: numberValue(astNode)}, true
+}
+
+// funcName returns the name of a function or, for a method, its receiver type and name, such as "T.String", so that
+// the methods of a type sort together
+func funcName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+	recv := decl.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	if index, ok := recv.(*ast.IndexExpr); ok { // a generic type
+		recv = index.X
+	}
+	if ident, ok := recv.(*ast.Ident); ok {
+		return ident.Name + "." + decl.Name.Name
+	}
+	return decl.Name.Name
+}
+
+// nodeValues returns the values assigned in a node or, for an expression such as an element of a slice, the node
+// itself
+func nodeValues(node ast.Node) []ast.Expr {
+	switch n := node.(type) {
+	case *ast.ValueSpec:
+		return n.Values
+	case *ast.AssignStmt:
+		return n.Rhs
+	case *ast.KeyValueExpr:
+		return []ast.Expr{n.Value}
+	case ast.Expr:
+		return []ast.Expr{n}
+	}
+	return nil
+}
+
+// nodeType returns the type given in a declaration or field
+func nodeType(node ast.Node) ast.Expr {
+	switch n := node.(type) {
+	case *ast.ValueSpec:
+		return n.Type
+	case *ast.Field:
+		return n.Type
+	case *ast.TypeSpec:
+		return n.Type
+	}
+	return nil
+}
+
+// numberValue returns the value of a number literal, which may be negated, or nil if "node" isn't one
+func numberValue(node ast.Node) *big.Float {
+	negate := false
+	if unary, ok := node.(*ast.UnaryExpr); ok && (unary.Op == token.SUB || unary.Op == token.ADD) {
+		negate = unary.Op == token.SUB
+		node = unary.X
+	}
+	lit, ok := node.(*ast.BasicLit)
+	if !ok || (lit.Kind != token.INT && lit.Kind != token.FLOAT) {
+		return nil
+	}
+	f, _, err := new(big.Float).SetPrec(1000).Parse(lit.Value, 0)
+	if err != nil {
+		return nil
+	}
+	if negate {
+		f.Neg(f)
+	}
+	return f
+}
+
+func (s sortNodes) render(node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, s.fset, node); err != nil {
+		panic(err)
+	}
+	return strings.TrimSpace(buf.String())
 }
 
 func (s sortNodes) renderNode(node dst.Node) string {
@@ -332,11 +1027,15 @@ func (s sortNodes) renderNode(node dst.Node) string {
 		}
 	}
 
-	var buf bytes.Buffer
-	if err := printer.Fprint(&buf, s.fset, stripComments(astNode)); err != nil {
-		panic(err)
+	return s.render(stripComments(astNode))
+}
+
+// renderEntry renders a whole node, including the type of a field
+func (s sortNodes) renderEntry(node dst.Node) string {
+	if field, ok := s.decorator.Ast.Nodes[node].(*ast.Field); ok {
+		return s.renderNode(node) + " " + s.render(field.Type)
 	}
-	return strings.TrimSpace(buf.String())
+	return s.renderNode(node)
 }
 
 func stripComments(n ast.Node) ast.Node {
@@ -376,6 +1075,7 @@ func stripComments(n ast.Node) ast.Node {
 	case *ast.FuncDecl:
 		v := new(ast.FuncDecl)
 		*v = *n
+		v.Doc = nil
 		return v
 	}
 	return n
@@ -1,7 +1,10 @@
 package gofmts
 
 import (
+	"bytes"
+	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"strings"
@@ -65,6 +68,14 @@ func TestSorter(t *testing.T) {
 			issues[0].(IssueWithReplacement).Replacement())
 	})
 
+	t.Run("it finds the sorted block when the printer removes lines before it", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t, "package main\n\n\n\nvar x = 1\n\n\n\nconst (\n\t//gofmts:sort\n\tZ = 2\n\tA = 1\n)\n"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, 11, issues[0].Position().Line)
+		assert.Equal(t, "\tA = 1\n\tZ = 2\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
 	t.Run("it works with a comment after the directive", func(t *testing.T) {
 		issues, err := srtr.Run(makeInputs(t,
 			//gofmts:go
@@ -208,7 +219,7 @@ func TestSorter(t *testing.T) {
 		assert.Equal(t, "\t\"not a number\",\n\t1,\n", issues[0].(IssueWithReplacement).Replacement())
 	})
 
-	t.Run("it fails back-to-back with unused directive", func(t *testing.T) {
+	t.Run("it sorts back-to-back blocks", func(t *testing.T) {
 		issues, err := srtr.Run(makeInputs(t,
 			//gofmts:go
 			`
@@ -228,8 +239,20 @@ func TestSorter(t *testing.T) {
 		assert.Equal(t, 4, issues[0].Position().Line)
 		require.Implements(t, (*IssueWithReplacement)(nil), issues[0])
 
-		assert.Equal(t, "unused directive `gofmts:sort`", issues[1].Details())
-		assert.Equal(t, 7, issues[1].Position().Line)
+		assert.Equal(t, "block is unsorted", issues[1].Details())
+		assert.Equal(t, 8, issues[1].Position().Line)
+		assert.Equal(t, "const B = 2\nconst Y = 1\n", issues[1].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts a block that follows the end of another", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			"package main\n\nvar a = []string{\n\t//gofmts:sort\n\t\"z\",\n\t\"y\",\n}\n\n"+
+				"//gofmts:sort decls\nfunc B() {}\n\nfunc A() {}\n"))
+		require.NoError(t, err)
+		require.Len(t, issues, 2)
+		assert.Equal(t, "\t\"y\",\n\t\"z\",\n", issues[0].(IssueWithReplacement).Replacement())
+		assert.Equal(t, "block is unsorted", issues[1].Details())
+		assert.Equal(t, 10, issues[1].Position().Line)
 	})
 
 	t.Run("unused directive", func(t *testing.T) {
@@ -261,4 +284,433 @@ func TestSorter(t *testing.T) {
 		assert.Equal(t, "unused directive `gofmts:sort`", issues[0].Details())
 		assert.Equal(t, 3, issues[0].Position().Line)
 	})
+
+	t.Run("it sorts by value", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				const (
+					//gofmts:sort by=value
+					A = 10
+					B = -1
+					C = 2
+				)
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\tB = -1\n\tC = 2\n\tA = 10\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts map entries by value and then by key", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				var m = map[string]string{
+					//gofmts:sort by=value
+					"c": "x",
+					"b": "y",
+					"a": "x",
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\t\"a\": \"x\",\n\t\"c\": \"x\",\n\t\"b\": \"y\",\n",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts struct fields by type", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				type T struct {
+					//gofmts:sort by=type
+					A string
+					B int
+					C bool
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\tC bool\n\tB int\n\tA string\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts by key explicitly", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				const (
+					//gofmts:sort by=key
+					A = 2
+					B = 1
+				)
+				`))
+		require.NoError(t, err)
+		assert.Empty(t, issues)
+	})
+
+	t.Run("it reports invalid options", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				const (
+					//gofmts:sort by=size
+					B = 1
+					A = 2
+				)
+				
+				const (
+					//gofmts:sort size=1
+					D = 1
+					C = 2
+				)
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 2)
+		assert.Equal(t, `failed directive "sort": option "by" must be one of key, value, type`, issues[0].Details())
+		assert.Equal(t, 4, issues[0].Position().Line)
+		assert.Equal(t, "unknown option \"size\" for directive `gofmts:sort`", issues[1].Details())
+	})
+
+	t.Run("it sorts naturally in reverse", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				const (
+					//gofmts:sort natural reverse
+					Item2  = 2
+					Item10 = 1
+					Item9  = 3
+				)
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\tItem10 = 1\n\tItem9  = 3\n\tItem2  = 2\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts ignoring case", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				var fruit = []string{
+					//gofmts:sort case-insensitive
+					"Zebra",
+					"apple",
+					"Apple",
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\t\"Apple\",\n\t\"apple\",\n\t\"Zebra\",\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts semantic versions", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				var versions = []string{
+					//gofmts:sort semver
+					"v1.10.0",
+					"v1.2.0",
+					"v1.2.0-rc.1",
+					"v1.2.0-beta.2",
+					"v1.2.0-beta.11",
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\t\"v1.2.0-beta.2\",\n\t\"v1.2.0-beta.11\",\n\t\"v1.2.0-rc.1\",\n\t\"v1.2.0\",\n\t\"v1.10.0\",\n",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it reports invalid modifiers", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				const (
+					//gofmts:sort reverse=maybe
+					B = 1
+					A = 2
+				)
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, `failed directive "sort": option "reverse" must be a boolean`, issues[0].Details())
+	})
+
+	t.Run("it reports duplicate keys", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				var codes = map[int]string{
+					//gofmts:sort unique
+					0x10: "a",
+					16:   "b",
+					17:   "c",
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		require.IsType(t, DuplicateEntryIssue{}, issues[0])
+		assert.Equal(t, "duplicate entry 16 (first on line 5)", issues[0].Details())
+		assert.Equal(t, 6, issues[0].Position().Line)
+	})
+
+	t.Run("it removes exact duplicates", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				var allowed = []string{
+					//gofmts:sort unique
+					"b",
+					"a",
+					"b",
+					"b", // keep me
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 3)
+		require.IsType(t, ExactDuplicateIssue{}, issues[0])
+		assert.Equal(t, `duplicate entry "b" (first on line 5)`, issues[0].Details())
+		assert.Equal(t, "7:1", fmt.Sprintf("%d:%d", issues[0].Position().Line, issues[0].Position().Column))
+		assert.Equal(t, 8, issues[0].(IssueWithReplacement).End().Line)
+		assert.Empty(t, issues[0].(IssueWithReplacement).Replacement())
+		assert.IsType(t, DuplicateEntryIssue{}, issues[1])
+		assert.Equal(t, "\t\"a\",\n\t\"b\",\n\t\"b\", // keep me\n", issues[2].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts the elements of a literal on one line", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:sort elements
+				var a = []string{"c", "a", "b"}
+				
+				//gofmts:sort elements by=value
+				var m = map[string]int{"z": 1, "y": 2, "x": 0}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 2)
+		assert.Equal(t, 4, issues[0].Position().Line)
+		assert.Equal(t, "var a = []string{\"a\", \"b\", \"c\"}\n", issues[0].(IssueWithReplacement).Replacement())
+		assert.Equal(t, "var m = map[string]int{\"x\": 0, \"z\": 1, \"y\": 2}\n",
+			issues[1].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts the elements of a literal on many lines", func(t *testing.T) {
+		// dst only keeps empty lines that are really empty
+		issues, err := srtr.Run(makeInputs(t,
+			"package main\n\n//gofmts:sort elements\nvar a = []string{\n\t\"c\", \"b\", // c and b\n\n\t// a\n\t\"a\",\n}\n"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\t// a\n\t\"a\", \"b\", // c and b\n\n\t\"c\",\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("the comments before the first element move with it", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:sort elements
+				var a = []int{
+					// three
+					3,
+					1,
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, 5, issues[0].Position().Line)
+		assert.Equal(t, "\t1,\n\t// three\n\t3,\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("elements must be followed by a composite literal", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				//gofmts:sort elements
+				var a = 1
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, `failed directive "sort": option "elements" must be followed by a composite literal`, issues[0].Details())
+	})
+
+	t.Run("it sorts switch cases and keeps the default last", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				func name(c Color) string {
+					switch c {
+					//gofmts:sort
+					case Red:
+						return "red"
+					default:
+						return "unknown"
+					case Green, Blue:
+						return "cool"
+					}
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\tcase Blue, Green:\n\t\treturn \"cool\"\n\tcase Red:\n\t\treturn \"red\"\n\tdefault:\n\t\treturn \"unknown\"\n",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts the expressions of a case", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				func small(i int) bool {
+					switch i {
+					//gofmts:sort
+					case 3, 10, 1:
+						return true
+					}
+					return false
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\tcase 1, 3, 10:\n\t\treturn true\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts select cases in reverse and keeps the default last", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				func receive(a, b chan int) {
+					select {
+					//gofmts:sort reverse
+					default:
+					case <-a:
+					case <-b:
+					}
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "\tcase <-b:\n\tcase <-a:\n\tdefault:\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it refuses to sort switches with fallthrough", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			//gofmts:go
+			`
+				package main
+				
+				func f(i int) {
+					switch i {
+					case 3:
+						fallthrough
+					//gofmts:sort
+					case 2:
+					case 1:
+					}
+				}
+				`))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, `failed directive "sort": cases of a switch with fallthrough can't be sorted`, issues[0].Details())
+		assert.Equal(t, 7, issues[0].Position().Line)
+	})
+
+	t.Run("it sorts functions and methods with their doc comments", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			"package main\n\n"+
+				"//gofmts:sort decls\n"+
+				"// Write writes.\nfunc (f *File) Write() {}\n\n"+
+				"func NewFile() *File { return nil }\n\n"+
+				"// Close closes.\n//\n// It can't be undone.\nfunc (f File) Close() {\n\tf.Write()\n}\n"+
+				"func Open() {}\n\n"+
+				"type Other struct{}\n\n"+
+				"func (Other) A() {}\n"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, 4, issues[0].Position().Line)
+		assert.Equal(t, 16, issues[0].(IssueWithReplacement).End().Line)
+		assert.Equal(t, "// Close closes.\n//\n// It can't be undone.\nfunc (f File) Close() {\n\tf.Write()\n}\n\n"+
+			"// Write writes.\nfunc (f *File) Write() {}\n\n"+
+			"func NewFile() *File { return nil }\n\n"+
+			"func Open() {}\n", issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("functions keep the empty lines around them when they are sorted", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t,
+			"package main\n\n"+
+				"//gofmts:sort decls\n"+
+				"func b() {}\n\n"+
+				"// a is documented.\nfunc a() {}\n\n"+
+				"func z() {}\n"+
+				"func y() {}\n"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, "// a is documented.\nfunc a() {}\n\nfunc b() {}\n\nfunc y() {}\n\nfunc z() {}\n",
+			issues[0].(IssueWithReplacement).Replacement())
+	})
+
+	t.Run("it sorts blocks inside the functions that it sorts", func(t *testing.T) {
+		fset, f := makeInputs(t, "package main\n\n//gofmts:sort decls\nfunc B() {\n\tconst (\n\t\t//gofmts:sort\n\t\tY = 1\n\t\tX = 2\n\t)\n}\n\nfunc A() {}\n")
+		issues, err := srtr.SortFile(fset, f)
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, 4, issues[0].Position().Line)
+		buf := new(bytes.Buffer)
+		require.NoError(t, format.Node(buf, fset, f))
+		assert.Equal(t, "package main\n\n//gofmts:sort decls\nfunc A() {}\n\nfunc B() {\n\tconst (\n\t\t//gofmts:sort\n\t\tX = 2\n\t\tY = 1\n\t)\n}\n",
+			buf.String())
+	})
+
+	t.Run("decls must be followed by a function", func(t *testing.T) {
+		issues, err := srtr.Run(makeInputs(t, "package main\n\n//gofmts:sort decls\ntype T struct{}\n"))
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Equal(t, `failed directive "sort": option "decls" must be followed by a function`, issues[0].Details())
+	})
+
+	t.Run("comments are counted back from a position", func(t *testing.T) {
+		fset, f := makeInputs(t, "package main\n\n// a\n/* b */ // c\nvar x = 1 // d\n\n// e\nvar y = 2\n")
+		pos := f.Decls[1].Pos()
+		line := func(p token.Pos) int { return fset.Position(p).Line }
+		assert.Equal(t, pos, commentsStart(f.Comments, pos, 0))
+		assert.Equal(t, 7, line(commentsStart(f.Comments, pos, 1)))
+		assert.Equal(t, 5, line(commentsStart(f.Comments, pos, 2)))
+		assert.Equal(t, 3, line(commentsStart(f.Comments, pos, 5)))
+		assert.Equal(t, pos, commentsStart(f.Comments, pos, 6))
+		assert.Equal(t, 3, line(commentsStart(f.Comments, f.Decls[0].Pos(), 3)))
+		assert.Equal(t, f.Decls[0].Pos(), commentsStart(f.Comments, f.Decls[0].Pos(), 4))
+	})
 }
@@ -0,0 +1,205 @@
+package gofmts
+
+import (
+	"strings"
+)
+
+// sortOrder is how a sort directive orders the nodes of its block
+type sortOrder struct {
+	by              string // the part of each node to sort by
+	reverse         bool   // sort in descending order
+	caseInsensitive bool   // ignore case, unless that is all that tells two keys apart
+	decls           bool   // sort the functions that follow, with their doc comments, rather than lines
+	elements        bool   // sort the elements of a composite literal, rather than lines
+	natural         bool   // compare runs of digits by their value, so that "Item2" sorts before "Item10"
+	semver          bool   // compare semantic versions by precedence, and anything else naturally
+	unique          bool   // report entries with the same key as an earlier entry
+}
+
+func parseSortOrder(options DirectiveOptions) (*sortOrder, error) {
+	var err error
+	order := &sortOrder{}
+	if order.by, err = options.Choice("by", sortCriteria...); err != nil {
+		return nil, err
+	}
+	for _, flag := range []struct {
+		name  string
+		value *bool
+	}{
+		{"case-insensitive", &order.caseInsensitive},
+		{"decls", &order.decls},
+		{"elements", &order.elements},
+		{"natural", &order.natural},
+		{"reverse", &order.reverse},
+		{"semver", &order.semver},
+		{"unique", &order.unique},
+	} {
+		if *flag.value, err = options.Bool(flag.name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// compare orders numbers by value and anything else by text, in ascending order
+func (o sortOrder) compare(a, b sortKey) int {
+	if a.number != nil && b.number != nil {
+		return a.number.Cmp(b.number)
+	}
+	if c := o.compareText(a.text, b.text); c != 0 {
+		return c
+	}
+	return strings.Compare(a.text, b.text)
+}
+
+func (o sortOrder) compareText(a, b string) int {
+	if o.caseInsensitive {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	if o.semver {
+		if va, ok := parseSemver(a); ok {
+			if vb, ok := parseSemver(b); ok {
+				if c := va.compare(vb); c != 0 {
+					return c
+				}
+			}
+		}
+	}
+	if o.natural || o.semver {
+		return compareNatural(a, b)
+	}
+	return strings.Compare(a, b)
+}
+
+// compareNatural compares strings a chunk at a time, where runs of digits are compared by their value and everything
+// else by text.  Numbers with the same value, such as "1" and "01", are then ordered by their text.
+func compareNatural(a, b string) int {
+	tie := 0 // the order of the first numbers with the same value but different text
+	for a != "" && b != "" {
+		var ca, cb string
+		ca, a = nextChunk(a)
+		cb, b = nextChunk(b)
+		if isDigit(ca[0]) && isDigit(cb[0]) {
+			if c := compareDigits(ca, cb); c != 0 {
+				return c
+			}
+			if tie == 0 {
+				tie = strings.Compare(ca, cb)
+			}
+		} else if c := strings.Compare(ca, cb); c != 0 {
+			return c
+		}
+	}
+	if c := strings.Compare(a, b); c != 0 {
+		return c
+	}
+	return tie
+}
+
+// nextChunk splits off a run of digits or a run of anything else from the start of "s"
+func nextChunk(s string) (chunk, rest string) {
+	digits := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// compareDigits compares two runs of digits by their value
+func compareDigits(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// semver is a semantic version, such as "v1.2.3-rc.1"
+type semver struct {
+	core       [3]string
+	prerelease []string
+}
+
+// parseSemver parses a version with an optional "v" prefix, which may be quoted as it would be in a string literal.
+// Build metadata is ignored.
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '`') && s[len(s)-1] == s[0] {
+		s = s[1 : len(s)-1]
+	}
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+		for _, id := range v.prerelease {
+			if id == "" {
+				return semver{}, false
+			}
+		}
+	}
+	core := strings.Split(s, ".")
+	if len(core) != len(v.core) {
+		return semver{}, false
+	}
+	for i, n := range core {
+		if !isNumber(n) {
+			return semver{}, false
+		}
+		v.core[i] = n
+	}
+	return v, true
+}
+
+// compare orders versions by precedence, so that a pre-release comes before its release
+func (v semver) compare(o semver) int {
+	for i := range v.core {
+		if c := compareDigits(v.core[i], o.core[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.prerelease) == 0 && len(o.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(o.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(o.prerelease); i++ {
+		a, b := v.prerelease[i], o.prerelease[i]
+		var c int
+		switch {
+		case isNumber(a) && isNumber(b):
+			c = compareDigits(a, b)
+		case isNumber(a):
+			c = -1 // numeric identifiers come before alphanumeric ones
+		case isNumber(b):
+			c = 1
+		default:
+			c = strings.Compare(a, b)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return len(v.prerelease) - len(o.prerelease)
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
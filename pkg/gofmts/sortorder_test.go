@@ -0,0 +1,43 @@
+package gofmts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortOrder(t *testing.T) {
+	for _, tc := range []struct {
+		order sortOrder
+		a, b  string
+	}{
+		{sortOrder{}, "Zebra", "apple"},
+		{sortOrder{}, "Item10", "Item2"},
+		{sortOrder{caseInsensitive: true}, "apple", "Zebra"},
+		{sortOrder{caseInsensitive: true}, "Apple", "apple"},
+		{sortOrder{natural: true}, "Item2", "Item10"},
+		{sortOrder{natural: true}, "a1b2", "a01b3"},
+		{sortOrder{natural: true}, "a01", "a1"},
+		{sortOrder{natural: true}, "a", "a1"},
+		{sortOrder{semver: true}, `"1.2.3"`, `"1.10.0"`},
+		{sortOrder{semver: true}, "v1.0.0-alpha", "v1.0.0-alpha.1"},
+		{sortOrder{semver: true}, "v1.0.0-alpha.1", "v1.0.0-alpha.beta"},
+		{sortOrder{semver: true}, "v1.0.0-beta.11", "v1.0.0-rc.1"},
+		{sortOrder{semver: true}, "v1.0.0-rc.1", "v1.0.0"},
+		{sortOrder{semver: true}, "v1.0.0", "v1.0.0+build"},
+		{sortOrder{semver: true}, "release2", "release10"},
+	} {
+		assert.Equal(t, -1, sign(tc.order.compare(sortKey{text: tc.a}, sortKey{text: tc.b})), "%+v: %s < %s", tc.order, tc.a, tc.b)
+		assert.Equal(t, 1, sign(tc.order.compare(sortKey{text: tc.b}, sortKey{text: tc.a})), "%+v: %s > %s", tc.order, tc.b, tc.a)
+	}
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,93 @@
+package gofmts
+
+import (
+	"go/parser"
+	"go/printer"
+	"go/token"
+
+	"github.com/pkg/errors"
+)
+
+// Keep these in sync with go/format/format.go.
+const (
+	printerMode = printer.UseSpaces | printer.TabIndent | printerNormalizeNumbers
+
+	// printerNormalizeNumbers means to canonicalize number literal prefixes
+	// and exponents while printing. See https://golang.org/doc/go1.13#gofmt.
+	//
+	// This value is defined in go/printer specifically for go/format and cmd/gofmt.
+	printerNormalizeNumbers = 1 << 30
+)
+
+// Options control how Source formats a file
+type Options struct {
+	// Filename is the name used in the positions of issues and errors
+	Filename string
+	// Config holds the settings for the formatter and sorter, and may be nil
+	Config *Config
+	// Fragment allows the source to be a list of declarations or statements, as gofmt does for standard input
+	Fragment bool
+	// NoTabStop indents formatted strings by a tab width past the column of the quote, rather than at the next tab stop
+	NoTabStop bool
+	// AllErrors reports all syntax errors, rather than just the first 10 on different lines
+	AllErrors bool
+}
+
+// Source does everything the gofmts command does to a file: it formats the strings marked with directives, formats
+// the result as gofmt does and then sorts the blocks marked for sorting.  It returns the new source along with the
+// issues found in "src", whose positions refer to "src".  Issues without replacements, such as unknown directives,
+// leave the source unchanged and are up to the caller to report.
+func Source(src []byte, opts Options) ([]byte, []Issue, error) {
+	parserMode := parser.ParseComments
+	if opts.AllErrors {
+		parserMode |= parser.AllErrors
+	}
+
+	formatter := NewFormatter()
+	if err := formatter.Configure(opts.Config); err != nil {
+		return nil, nil, err
+	}
+	sorter := NewSorter()
+	sorter.Configure(opts.Config)
+
+	fset := token.NewFileSet()
+	file, parsedSrc, sourceAdj, indentAdj, err := parse(fset, opts.Filename, src, opts.Fragment, parserMode)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := decorateFile(fset, file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// format the strings and then sort the blocks that hold them, both in the same tree
+	tabStopSrc := parsedSrc
+	if opts.NoTabStop {
+		tabStopSrc = nil // without the source, formatted strings aren't positioned at the next tab stop
+	}
+	issues, _ := formatter.run(d, tabStopSrc)
+	sortIssues, sorted := sorter.run(d)
+
+	restorer, restored, err := d.restore()
+	if err != nil {
+		return nil, nil, err
+	}
+	printerConfig := printer.Config{Mode: printerMode, Tabwidth: tabWidth}
+	res, err := printFile(restorer.Fset, restored, sourceAdj, indentAdj, src, printerConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the replacements of the sorted blocks are found in the result, which is parsed again in the same way as "src"
+	if sorted {
+		printedFset := token.NewFileSet()
+		printed, _, _, _, err := parse(printedFset, opts.Filename, res, opts.Fragment, parser.ParseComments)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to parse sorted source")
+		}
+		if err := setSortReplacements(sortIssues, restorer, restored, res, printedFset, printed); err != nil {
+			return nil, nil, err
+		}
+	}
+	return res, append(issues, sortIssues...), nil
+}
@@ -0,0 +1,143 @@
+package gofmts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	t.Run("formats, prints and sorts a file", func(t *testing.T) {
+		src := "package p\n\n//gofmts:json\nconst j =   `[1,2]`\n\nconst (\n\t//gofmts:sort\n\tZ = 1\n\tA = 2\n)\n"
+		res, issues, err := Source([]byte(src), Options{Filename: "p.go"})
+		require.NoError(t, err)
+		assert.Equal(t, "package p\n\n//gofmts:json\nconst j = `\n\t\t[1, 2]\n\t\t`\n\nconst (\n\t//gofmts:sort\n\tA = 2\n\tZ = 1\n)\n",
+			string(res))
+		require.Len(t, issues, 2)
+		assert.IsType(t, FormatIssue{}, issues[0])
+		assert.Equal(t, "p.go:4:13", issues[0].Position().String())
+		assert.IsType(t, SortIssue{}, issues[1])
+		assert.Equal(t, "p.go:8:1", issues[1].Position().String())
+	})
+
+	t.Run("fixing the issues gives the same result", func(t *testing.T) {
+		src := "package p\n\n//gofmts:json\nconst j = `[1,2]`\n\nconst (\n\t//gofmts:sort\n\tZ = 1\n\t//gofmts:json\n\tA = `[1,2]`\n)\n"
+		res, issues, err := Source([]byte(src), Options{})
+		require.NoError(t, err)
+		assert.Equal(t, "package p\n\n//gofmts:json\nconst j = `\n\t\t[1, 2]\n\t\t`\n\n"+
+			"const (\n\t//gofmts:sort\n\t//gofmts:json\n\tA = `\n\t\t[1, 2]\n\t\t`\n\tZ = 1\n)\n", string(res))
+		require.Len(t, issues, 3)
+
+		// the sorted block already holds the formatted string, so the edit to the string itself gives way
+		edits, unresolved := NewEdits(issues)
+		require.Len(t, unresolved, 1)
+		assert.Equal(t, issues[1], unresolved[0].(EditConflict).Issue())
+		fixed, err := edits.Apply([]byte(src))
+		require.NoError(t, err)
+		assert.Equal(t, string(res), string(fixed))
+	})
+
+	t.Run("sql with a trailing comment is formatted", func(t *testing.T) {
+		src := "package p\n\n//gofmts:sql\nconst q = \"select * from t where a = 'x' -- trailing\\n\"\n"
+		res, issues, err := Source([]byte(src), Options{})
+		require.NoError(t, err)
+		require.Len(t, issues, 1)
+		assert.Contains(t, string(res), "a = 'x' -- trailing")
+	})
+
+	t.Run("exact duplicates are removed", func(t *testing.T) {
+		src := "package p\n\nvar a = []string{\n\t//gofmts:sort unique\n\t\"b\",\n\t\"a\",\n\t\"a\",\n\n\t\"z\",\n}\n\n" +
+			"var b = []string{\n\t//gofmts:sort unique\n\t\"x\",\n\t\"y\",\n\t\"x\",\n\n\t\"z\",\n}\n"
+		res, issues, err := Source([]byte(src), Options{})
+		require.NoError(t, err)
+		assert.Equal(t, "package p\n\nvar a = []string{\n\t//gofmts:sort unique\n\t\"a\",\n\t\"b\",\n\n\t\"z\",\n}\n\n"+
+			"var b = []string{\n\t//gofmts:sort unique\n\t\"x\",\n\t\"y\",\n\n\t\"z\",\n}\n", string(res))
+		require.Len(t, issues, 3)
+
+		// the sorted block no longer has its duplicate, which can be removed on its own from a block that is sorted
+		edits, unresolved := NewEdits(issues)
+		require.Len(t, unresolved, 1)
+		assert.Equal(t, issues[0], unresolved[0].(EditConflict).Issue())
+		fixed, err := edits.Apply([]byte(src))
+		require.NoError(t, err)
+		assert.Equal(t, string(res), string(fixed))
+	})
+
+	t.Run("exact duplicates are removed from literals on one line", func(t *testing.T) {
+		src := "package p\n\n//gofmts:sort elements unique\nvar a = []int{1, 1, 2}\n"
+		res, issues, err := Source([]byte(src), Options{})
+		require.NoError(t, err)
+		assert.Equal(t, "package p\n\n//gofmts:sort elements unique\nvar a = []int{1, 2}\n", string(res))
+		require.Len(t, issues, 1)
+
+		edits, unresolved := NewEdits(issues)
+		require.Empty(t, unresolved)
+		fixed, err := edits.Apply([]byte(src))
+		require.NoError(t, err)
+		assert.Equal(t, string(res), string(fixed))
+	})
+
+	t.Run("sorted declarations can gain lines", func(t *testing.T) {
+		// C gains an empty line before its doc comment, so the blocks after it move down
+		src := "package p\n\n//gofmts:sort decls\nfunc A() {}\n\n// C is last.\nfunc C() {}\nfunc B() {}\n\n" +
+			"//gofmts:json\nvar j = `[1,2]`\n\nconst (\n\t//gofmts:sort\n\tZ = 1\n\tY = 2\n)\n"
+		res, issues, err := Source([]byte(src), Options{})
+		require.NoError(t, err)
+		assert.Equal(t, "package p\n\n//gofmts:sort decls\nfunc A() {}\n\nfunc B() {}\n\n// C is last.\nfunc C() {}\n\n"+
+			"//gofmts:json\nvar j = `\n\t\t[1, 2]\n\t\t`\n\nconst (\n\t//gofmts:sort\n\tY = 2\n\tZ = 1\n)\n", string(res))
+		require.Len(t, issues, 3)
+
+		edits, unresolved := NewEdits(issues)
+		require.Empty(t, unresolved)
+		fixed, err := edits.Apply([]byte(src))
+		require.NoError(t, err)
+		assert.Equal(t, string(res), string(fixed))
+	})
+
+	t.Run("sorted blocks are found after lines that gofmt removes", func(t *testing.T) {
+		src := "package p\n\n\n\n//gofmts:json\nvar j = `[1,2]`\n\n\n\nconst (\n\t//gofmts:sort\n\tZ = 1\n\t// Y is second.\n" +
+			"\tY = 2\n)\n\n\n//gofmts:sort decls\nfunc B() {}\nfunc A() {}\n"
+		res, issues, err := Source([]byte(src), Options{})
+		require.NoError(t, err)
+		assert.Equal(t, "package p\n\n//gofmts:json\nvar j = `\n\t\t[1, 2]\n\t\t`\n\nconst (\n\t//gofmts:sort\n\t// Y is second.\n"+
+			"\tY = 2\n\tZ = 1\n)\n\n//gofmts:sort decls\nfunc A() {}\nfunc B() {}\n", string(res))
+		require.Len(t, issues, 3)
+
+		// the extra empty lines are left to gofmt, but the blocks are fixed
+		edits, unresolved := NewEdits(issues)
+		require.Empty(t, unresolved)
+		fixed, err := edits.Apply([]byte(src))
+		require.NoError(t, err)
+		assert.Equal(t, "package p\n\n\n\n//gofmts:json\nvar j = `\n\t\t[1, 2]\n\t\t`\n\n\n\nconst (\n\t//gofmts:sort\n"+
+			"\t// Y is second.\n\tY = 2\n\tZ = 1\n)\n\n\n//gofmts:sort decls\nfunc A() {}\nfunc B() {}\n", string(fixed))
+	})
+
+	t.Run("fragments", func(t *testing.T) {
+		src := "\n\t//gofmts:json\n\tx :=  `[1,2]`\n"
+		_, _, err := Source([]byte(src), Options{})
+		require.Error(t, err)
+
+		res, issues, err := Source([]byte(src), Options{Fragment: true})
+		require.NoError(t, err)
+		assert.Equal(t, "\n\t//gofmts:json\n\tx := `\n\t\t[1, 2]\n\t\t`\n", string(res))
+		require.Len(t, issues, 1)
+		assert.Equal(t, 3, issues[0].Position().Line)
+	})
+
+	t.Run("without tab stops", func(t *testing.T) {
+		src := "package p\n\n//gofmts:json\nconst j = `[1,2]`\n"
+		res, _, err := Source([]byte(src), Options{NoTabStop: true})
+		require.NoError(t, err)
+		assert.Equal(t, "package p\n\n//gofmts:json\nconst j = `\n\t\t   [1, 2]\n\t\t   `\n", string(res))
+	})
+
+	t.Run("issues without replacements are returned", func(t *testing.T) {
+		src := "package p\n\n//gofmts:nope\nconst a = `x`\n"
+		res, issues, err := Source([]byte(src), Options{Config: &Config{}})
+		require.NoError(t, err)
+		assert.Equal(t, src, string(res))
+		require.Len(t, issues, 1)
+		assert.IsType(t, UnknownDirective{}, issues[0])
+	})
+}
@@ -0,0 +1,913 @@
+package gofmts
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/sqlfmt"
+	"github.com/pkg/errors"
+)
+
+var sqlOptions = []string{"case"}
+
+// sqlFormatter formats a string containing SQL in a given dialect
+type sqlFormatter struct {
+	dialect *sqlDialect
+}
+
+func (f sqlFormatter) Format(value string, opts DirectiveOptions) (string, error) {
+	keywordCase, err := opts.Choice("case", "upper", "lower")
+	if err != nil {
+		return "", err
+	}
+	upperCase := keywordCase == "upper"
+	tokens, err := lexSql(f.dialect, value)
+	if err != nil {
+		return "", err
+	}
+	statements := splitSqlStatements(tokens)
+	out := new(strings.Builder)
+	for i, stmt := range statements {
+		if i > 0 {
+			out.WriteString("\n\n")
+		}
+		for _, c := range stmt.comments {
+			out.WriteString(c.text)
+			out.WriteString("\n")
+		}
+		if len(stmt.tokens) > 0 {
+			formatted, err := f.formatStatement(value, stmt.tokens, upperCase)
+			if err != nil {
+				if len(statements) > 1 {
+					return "", errors.Wrapf(err, "statement %d", i+1)
+				}
+				return "", err
+			}
+			out.WriteString(strings.TrimSpace(formatted))
+		}
+		if stmt.terminated {
+			out.WriteString(";")
+		}
+		if stmt.trailingComment != nil {
+			out.WriteString(" ")
+			out.WriteString(stmt.trailingComment.text)
+		}
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+func (f sqlFormatter) formatStatement(value string, tokens []sqlToken, upperCase bool) (string, error) {
+	p := sqlPrinter{dialect: f.dialect, upperCase: upperCase}
+	if isSqlDdl(tokens) {
+		if err := p.ddl(tokens); err != nil {
+			return "", err
+		}
+		return p.String(), nil
+	}
+	// the postgresql parser drops comments, so statements with them are laid out like those of the other dialects
+	if f.dialect == postgresqlDialect && !hasSqlComments(tokens) {
+		return formatPostgresql(value, tokens, upperCase)
+	}
+	if err := p.query(tokens, 0); err != nil {
+		return "", err
+	}
+	return p.String(), nil
+}
+
+// sqlStatement is one statement of a script, along with the comments that precede it
+type sqlStatement struct {
+	comments        []sqlToken // comments on the lines before the statement
+	tokens          []sqlToken
+	terminated      bool      // the statement ends with a semicolon
+	trailingComment *sqlToken // a comment following the semicolon on the same line
+}
+
+// splitSqlStatements splits a script into statements at the semicolons outside of parentheses and BEGIN ... END
+// blocks, such as the body of a trigger.  Comments between statements are kept with the statement that follows them,
+// unless they share a line with the preceding semicolon.
+func splitSqlStatements(tokens []sqlToken) []sqlStatement {
+	var statements []sqlStatement
+	var stmt sqlStatement
+	depth := 0
+	blocks := sqlBlockDepths(tokens)
+	for i, tok := range tokens {
+		isComment := tok.kind == sqlLineComment || tok.kind == sqlBlockComment
+		switch {
+		case isComment && len(stmt.tokens) == 0:
+			if !tok.newlineBefore && i > 0 && isSqlPunctuation(tokens[i-1], ";") && len(statements) > 0 {
+				statements[len(statements)-1].trailingComment = &tokens[i]
+				continue
+			}
+			stmt.comments = append(stmt.comments, tok)
+		case isSqlPunctuation(tok, ";") && depth == 0 && blocks[i] == 0:
+			stmt.terminated = true
+			if len(stmt.tokens) > 0 || len(stmt.comments) > 0 {
+				statements = append(statements, stmt)
+			}
+			stmt = sqlStatement{}
+		default:
+			switch {
+			case isSqlPunctuation(tok, "("):
+				depth++
+			case isSqlPunctuation(tok, ")"):
+				depth--
+			}
+			stmt.tokens = append(stmt.tokens, tok)
+		}
+	}
+	if len(stmt.tokens) > 0 || len(stmt.comments) > 0 {
+		statements = append(statements, stmt)
+	}
+	return statements
+}
+
+// sqlBlockDepths returns how many BEGIN ... END blocks enclose each token.  A BEGIN that starts a statement begins a
+// transaction rather than a block, and the END of a CASE expression or of END IF, END LOOP and the like doesn't close
+// a block.
+func sqlBlockDepths(tokens []sqlToken) []int {
+	depths := make([]int, len(tokens))
+	var open []bool // whether each BEGIN or CASE that hasn't ended opened a block
+	depth := 0
+	statementStart := true
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		depths[i] = depth
+		switch {
+		case tok.kind == sqlLineComment || tok.kind == sqlBlockComment:
+			continue
+		case isSqlWord(tok, "BEGIN") && !statementStart:
+			open = append(open, true)
+			depth++
+		case isSqlWord(tok, "CASE"):
+			open = append(open, false)
+		case isSqlWord(tok, "END") && len(open) > 0:
+			next := ""
+			if i+1 < len(tokens) && tokens[i+1].kind == sqlWord {
+				next = strings.ToUpper(tokens[i+1].text)
+			}
+			switch next {
+			case "IF", "LOOP", "REPEAT", "WHILE":
+				// ends a control statement, which didn't open anything
+			case "CASE":
+				// ends a CASE statement, so its CASE doesn't open another
+				i++
+				depths[i] = depth
+				open = open[:len(open)-1]
+			default:
+				if open[len(open)-1] {
+					depth--
+				}
+				open = open[:len(open)-1]
+			}
+		}
+		statementStart = isSqlPunctuation(tok, ";")
+	}
+	return depths
+}
+
+// formatPostgresql formats a statement using a full PostgreSQL parser.  Because the parser doesn't understand
+// placeholders, they are replaced by identifiers before parsing and restored afterwards.
+func formatPostgresql(value string, tokens []sqlToken, upperCase bool) (string, error) {
+	var placeholders []string
+	substituted := new(strings.Builder)
+	last := tokens[0].offset
+	for _, tok := range tokens {
+		if tok.kind != sqlPlaceholder {
+			continue
+		}
+		substituted.WriteString(value[last:tok.offset])
+		fmt.Fprintf(substituted, sqlPlaceholderIdentifier, len(placeholders))
+		placeholders = append(placeholders, tok.text)
+		last = tok.offset + len(tok.text)
+	}
+	end := tokens[len(tokens)-1]
+	substituted.WriteString(value[last : end.offset+len(end.text)])
+	substituted.WriteString("\n") // see renderPostgresql
+
+	formatted, err := renderPostgresql(substituted.String(), upperCase)
+	if err != nil {
+		return "", err
+	}
+	// restore in reverse so that a placeholder's identifier is never a prefix of one that remains
+	for i := len(placeholders) - 1; i >= 0; i-- {
+		formatted = strings.Replace(formatted, fmt.Sprintf(sqlPlaceholderIdentifier, i), placeholders[i], 1)
+	}
+	return formatted, nil
+}
+
+const sqlPlaceholderIdentifier = "gofmts_placeholder_%d"
+
+// renderPostgresql parses and lays out a statement with the postgresql parser, reporting its panics as errors.  The
+// parser's lexer never finishes a line comment that isn't followed by a newline, and it can't be stopped, so a
+// statement that doesn't end with one is rejected rather than parsed.
+func renderPostgresql(sql string, upperCase bool) (formatted string, err error) {
+	if !strings.HasSuffix(sql, "\n") {
+		return "", errors.New("unable to parse sql: statement must end with a newline")
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("unable to parse sql: %v", r)
+		}
+	}()
+	lexer := sqlfmt.NewSqlLexer(sql)
+	stmt, err := sqlfmt.Parse(lexer)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to parse sql")
+	}
+	outBuf := new(bytes.Buffer)
+	r := sqlfmt.NewTextRenderer(outBuf)
+	r.UpperCase = upperCase
+	stmt.RenderTo(r)
+	return outBuf.String(), nil
+}
+
+// hasSqlComments reports whether any of "tokens" is a comment
+func hasSqlComments(tokens []sqlToken) bool {
+	for _, tok := range tokens {
+		if tok.kind == sqlLineComment || tok.kind == sqlBlockComment {
+			return true
+		}
+	}
+	return false
+}
+
+type sqlClauseStyle int
+
+const (
+	sqlListClause      sqlClauseStyle = iota // one item per line, indented below the keyword
+	sqlConditionClause                       // indented below the keyword, with AND and OR starting new lines
+	sqlTableClause                           // like a list, but joins and the conditions that follow them start new lines
+	sqlInlineClause                          // contents follow the keyword on the same line
+	sqlBareClause                            // keyword stands alone on its line
+)
+
+type sqlClause struct {
+	keywords []string
+	style    sqlClauseStyle
+	// after lists the clauses that must precede this one for its keywords to start a clause, if any
+	after []string
+	// spaceBeforeParen separates a table name from the column list that follows it
+	spaceBeforeParen bool
+}
+
+func (c *sqlClause) name() string {
+	return strings.Join(c.keywords, " ")
+}
+
+// sqlClauses lists the keywords that start clauses, with longer sequences first so that they match first
+var sqlClauses = []*sqlClause{
+	{keywords: []string{"ON", "DUPLICATE", "KEY", "UPDATE"}, style: sqlListClause},
+	{keywords: []string{"INSERT", "IGNORE", "INTO"}, style: sqlListClause, spaceBeforeParen: true},
+	{keywords: []string{"LOCK", "IN", "SHARE", "MODE"}, style: sqlBareClause},
+	{keywords: []string{"SELECT", "DISTINCT"}, style: sqlListClause},
+	{keywords: []string{"SELECT", "ALL"}, style: sqlListClause},
+	{keywords: []string{"INSERT", "INTO"}, style: sqlListClause, spaceBeforeParen: true},
+	{keywords: []string{"REPLACE", "INTO"}, style: sqlListClause, spaceBeforeParen: true},
+	{keywords: []string{"DELETE", "FROM"}, style: sqlListClause},
+	{keywords: []string{"GROUP", "BY"}, style: sqlListClause},
+	{keywords: []string{"ORDER", "BY"}, style: sqlListClause},
+	{keywords: []string{"UNION", "ALL"}, style: sqlBareClause},
+	{keywords: []string{"FOR", "UPDATE"}, style: sqlBareClause},
+	{keywords: []string{"FOR", "SHARE"}, style: sqlBareClause},
+	{keywords: []string{"WITH", "RECURSIVE"}, style: sqlListClause, after: []string{""}},
+	{keywords: []string{"SELECT"}, style: sqlListClause},
+	{keywords: []string{"FROM"}, style: sqlTableClause},
+	{keywords: []string{"WHERE"}, style: sqlConditionClause},
+	{keywords: []string{"HAVING"}, style: sqlConditionClause},
+	{keywords: []string{"LIMIT"}, style: sqlInlineClause},
+	{keywords: []string{"OFFSET"}, style: sqlInlineClause},
+	{keywords: []string{"RETURNING"}, style: sqlListClause},
+	{keywords: []string{"UPDATE"}, style: sqlListClause, after: []string{""}},
+	{keywords: []string{"WITH"}, style: sqlListClause, after: []string{""}},
+	{keywords: []string{"SET"}, style: sqlListClause, after: []string{"UPDATE", "INSERT INTO", "INSERT IGNORE INTO", "REPLACE INTO"}},
+	{keywords: []string{"VALUES"}, style: sqlListClause, after: []string{"INSERT INTO", "INSERT IGNORE INTO", "REPLACE INTO"}},
+	{keywords: []string{"UNION"}, style: sqlBareClause},
+	{keywords: []string{"INTERSECT"}, style: sqlBareClause},
+	{keywords: []string{"EXCEPT"}, style: sqlBareClause},
+}
+
+// sqlJoinModifiers are the words that may precede JOIN
+var sqlJoinModifiers = map[string]bool{
+	"CROSS":   true,
+	"FULL":    true,
+	"INNER":   true,
+	"LEFT":    true,
+	"NATURAL": true,
+	"OUTER":   true,
+	"RIGHT":   true,
+}
+
+// sqlKeywords are the words whose case is normalized
+var sqlKeywords = map[string]bool{
+	"ADD":            true,
+	"ALL":            true,
+	"ALTER":          true,
+	"AND":            true,
+	"ANY":            true,
+	"ARRAY":          true,
+	"AS":             true,
+	"ASC":            true,
+	"AUTOINCREMENT":  true,
+	"AUTO_INCREMENT": true,
+	"BEGIN":          true,
+	"BETWEEN":        true,
+	"BY":             true,
+	"CASCADE":        true,
+	"CASE":           true,
+	"CAST":           true,
+	"CHECK":          true,
+	"COLLATE":        true,
+	"COLUMN":         true,
+	"CONSTRAINT":     true,
+	"CREATE":         true,
+	"CROSS":          true,
+	"DEFAULT":        true,
+	"DELETE":         true,
+	"DESC":           true,
+	"DISTINCT":       true,
+	"DIV":            true,
+	"DROP":           true,
+	"DUPLICATE":      true,
+	"ELSE":           true,
+	"END":            true,
+	"ESCAPE":         true,
+	"EXCEPT":         true,
+	"EXISTS":         true,
+	"FALSE":          true,
+	"FOR":            true,
+	"FOREIGN":        true,
+	"FROM":           true,
+	"FULL":           true,
+	"GLOB":           true,
+	"GROUP":          true,
+	"HAVING":         true,
+	"IF":             true,
+	"IGNORE":         true,
+	"ILIKE":          true,
+	"IN":             true,
+	"INDEX":          true,
+	"INNER":          true,
+	"INSERT":         true,
+	"INTERSECT":      true,
+	"INTERVAL":       true,
+	"INTO":           true,
+	"IS":             true,
+	"JOIN":           true,
+	"KEY":            true,
+	"LEFT":           true,
+	"LIKE":           true,
+	"LIMIT":          true,
+	"LOCK":           true,
+	"MODE":           true,
+	"NATURAL":        true,
+	"NOT":            true,
+	"NULL":           true,
+	"NULLS":          true,
+	"OFFSET":         true,
+	"ON":             true,
+	"OR":             true,
+	"ORDER":          true,
+	"OUTER":          true,
+	"OVER":           true,
+	"PARTITION":      true,
+	"PRIMARY":        true,
+	"RECURSIVE":      true,
+	"REFERENCES":     true,
+	"REGEXP":         true,
+	"RENAME":         true,
+	"REPLACE":        true,
+	"RESTRICT":       true,
+	"RETURNING":      true,
+	"RIGHT":          true,
+	"ROLLUP":         true,
+	"SELECT":         true,
+	"SET":            true,
+	"SHARE":          true,
+	"SOME":           true,
+	"STRAIGHT_JOIN":  true,
+	"TABLE":          true,
+	"TEMP":           true,
+	"TEMPORARY":      true,
+	"THEN":           true,
+	"TO":             true,
+	"TRUE":           true,
+	"TRUNCATE":       true,
+	"UNION":          true,
+	"UNIQUE":         true,
+	"UPDATE":         true,
+	"USING":          true,
+	"VALUES":         true,
+	"VIEW":           true,
+	"WHEN":           true,
+	"WHERE":          true,
+	"WITH":           true,
+	"XOR":            true,
+}
+
+// sqlContextualKeywords are keywords that are often used as identifiers, such as for a column called "key", so they
+// are only treated as keywords after one of the words listed for them
+var sqlContextualKeywords = map[string]map[string]bool{
+	"DUPLICATE": {"ON": true},
+	"KEY":       {"DUPLICATE": true, "FOREIGN": true, "PRIMARY": true, "UNIQUE": true},
+	"MODE":      {"SHARE": true},
+	"SHARE":     {"FOR": true, "IN": true},
+	"TEMP":      {"CREATE": true, "REPLACE": true},
+	"TEMPORARY": {"CREATE": true, "REPLACE": true},
+}
+
+// sqlFunctionKeywords are keywords that are written like function calls, without a space before the parenthesis
+var sqlFunctionKeywords = map[string]bool{
+	"CAST":    true,
+	"LEFT":    true,
+	"REPLACE": true,
+	"RIGHT":   true,
+	"VALUES":  true,
+}
+
+// sqlTypes are the column types whose case is normalized.  Like functions, they take no space before their arguments.
+// Since types such as TEXT are also common column names, they are only treated as keywords where a type may appear.
+var sqlTypes = map[string]bool{
+	"BIGINT":      true,
+	"BIGSERIAL":   true,
+	"BLOB":        true,
+	"BOOLEAN":     true,
+	"BYTEA":       true,
+	"CHAR":        true,
+	"DATETIME":    true,
+	"DECIMAL":     true,
+	"DOUBLE":      true,
+	"FLOAT":       true,
+	"INT":         true,
+	"INTEGER":     true,
+	"NUMERIC":     true,
+	"PRECISION":   true,
+	"REAL":        true,
+	"SERIAL":      true,
+	"SMALLINT":    true,
+	"TEXT":        true,
+	"TIMESTAMP":   true,
+	"TIMESTAMPTZ": true,
+	"TINYINT":     true,
+	"VARCHAR":     true,
+}
+
+// sqlDdlKeywords start statements that define the schema rather than query it
+var sqlDdlKeywords = map[string]bool{
+	"ALTER":    true,
+	"CREATE":   true,
+	"DROP":     true,
+	"RENAME":   true,
+	"TRUNCATE": true,
+}
+
+// sqlNamedObjectKeywords precede the name of a table in DDL, which is separated from a following column list
+var sqlNamedObjectKeywords = map[string]bool{
+	"EXISTS":     true,
+	"ON":         true,
+	"REFERENCES": true,
+	"TABLE":      true,
+}
+
+const sqlIndent = "  "
+
+// sqlPrinter lays out a sequence of sql tokens, one clause at a time
+type sqlPrinter struct {
+	dialect   *sqlDialect
+	upperCase bool
+
+	buf              []byte
+	lineStart        bool // nothing has been written on the current line
+	lastBreak        int  // offset in buf of the last line break
+	indent           int  // indent of the current line
+	pendingNewline   bool // a line comment has been written, so the next token must start a new line
+	prev             *sqlToken
+	prevKeyword      bool // the previous token was a keyword rather than an identifier
+	prevUnary        bool
+	casts            []bool // whether each open parenthesis holds the arguments of CAST
+	spaceBeforeParen bool
+	inDdl            bool
+	beforeName       *sqlToken // the token before the current, possibly qualified, name
+}
+
+func (p *sqlPrinter) String() string {
+	return string(p.buf)
+}
+
+func (p *sqlPrinter) newline(indent int) {
+	p.pendingNewline = false
+	p.indent = indent
+	if len(p.buf) == 0 {
+		return
+	}
+	p.lastBreak = len(p.buf)
+	p.buf = append(p.buf, '\n')
+	p.buf = append(p.buf, strings.Repeat(sqlIndent, indent)...)
+	p.lineStart = true
+}
+
+func (p *sqlPrinter) write(tok sqlToken) {
+	isComment := tok.kind == sqlLineComment || tok.kind == sqlBlockComment
+	if isComment && !tok.newlineBefore && p.lineStart && p.lastBreak > 0 {
+		// keep a trailing comment on the line it was written on
+		p.buf = p.buf[:p.lastBreak]
+		p.lineStart = false
+		defer p.newline(p.indent)
+	} else if p.pendingNewline {
+		p.newline(p.indent)
+	}
+
+	text := tok.text
+	keyword := tok.kind == sqlWord && p.isKeyword(tok)
+	if keyword {
+		if p.upperCase {
+			text = strings.ToUpper(text)
+		} else {
+			text = strings.ToLower(text)
+		}
+	}
+	if !p.lineStart && len(p.buf) > 0 && p.needsSpace(tok) {
+		p.buf = append(p.buf, ' ')
+	}
+	p.buf = append(p.buf, text...)
+	p.lineStart = false
+	p.prevUnary = tok.kind == sqlOperator && (tok.text == "-" || tok.text == "+" || tok.text == "~") && p.startsOperand()
+	if !isSqlPunctuation(tok, ".") && (p.prev == nil || !isSqlPunctuation(*p.prev, ".")) {
+		p.beforeName = p.prev
+	}
+	switch {
+	case isSqlPunctuation(tok, "("):
+		p.casts = append(p.casts, p.prev != nil && p.prevKeyword && isSqlWord(*p.prev, "CAST"))
+	case isSqlPunctuation(tok, ")") && len(p.casts) > 0:
+		p.casts = p.casts[:len(p.casts)-1]
+	}
+	p.prev = &tok
+	p.prevKeyword = keyword
+	if tok.kind == sqlLineComment {
+		p.pendingNewline = true
+	}
+}
+
+// isKeyword reports whether a word is used as a keyword, rather than as an identifier that happens to share its name
+func (p *sqlPrinter) isKeyword(tok sqlToken) bool {
+	upper := strings.ToUpper(tok.text)
+	if p.prev != nil && isSqlPunctuation(*p.prev, ".") {
+		return false // the column of a qualified name
+	}
+	if sqlTypes[upper] {
+		return p.expectsType()
+	}
+	if after, ok := sqlContextualKeywords[upper]; ok {
+		return p.prev != nil && p.prevKeyword && after[strings.ToUpper(p.prev.text)]
+	}
+	return sqlKeywords[upper]
+}
+
+// expectsType reports whether the next word is a type, as after "::", in CAST(x AS ...), after another type or after
+// the name of a column in DDL
+func (p *sqlPrinter) expectsType() bool {
+	prev := p.prev
+	switch {
+	case prev == nil:
+		return false
+	case prev.text == "::":
+		return true
+	case prev.kind == sqlWord && p.prevKeyword && sqlTypes[strings.ToUpper(prev.text)]:
+		return true // such as DOUBLE PRECISION
+	case isSqlWord(*prev, "AS"):
+		return len(p.casts) > 0 && p.casts[len(p.casts)-1]
+	case p.inDdl:
+		return prev.kind == sqlQuotedIdentifier || prev.kind == sqlWord && !p.prevKeyword
+	}
+	return false
+}
+
+// startsOperand reports whether the previous token leaves us expecting an operand, such that a following '-' is unary
+func (p *sqlPrinter) startsOperand() bool {
+	if p.prev == nil {
+		return true
+	}
+	switch p.prev.kind {
+	case sqlOperator:
+		return true
+	case sqlPunctuation:
+		return p.prev.text != ")" && p.prev.text != "]"
+	case sqlWord:
+		return p.prevKeyword
+	}
+	return false
+}
+
+func (p *sqlPrinter) needsSpace(tok sqlToken) bool {
+	prev := p.prev
+	if prev == nil {
+		return false
+	}
+	if p.prevUnary {
+		return false
+	}
+	if tok.kind == sqlPunctuation && tok.text != "(" {
+		return false // no space before , ; . ) or the brackets of an array subscript
+	}
+	if prev.kind == sqlPunctuation && (prev.text == "(" || prev.text == "[" || prev.text == ".") {
+		return false
+	}
+	if prev.text == "::" || tok.text == "::" || prev.text == ":" || tok.text == ":" {
+		return false // casts and array slices
+	}
+	if tok.text == "(" {
+		switch prev.kind {
+		case sqlWord:
+			if upper := strings.ToUpper(prev.text); p.prevKeyword {
+				return !sqlTypes[upper] && !sqlFunctionKeywords[upper]
+			}
+			return p.spaceBeforeParen || p.followsObjectKeyword()
+		case sqlQuotedIdentifier:
+			return p.spaceBeforeParen || p.followsObjectKeyword()
+		}
+	}
+	return true
+}
+
+// query lays out a statement or subquery with its clauses at "indent"
+func (p *sqlPrinter) query(tokens []sqlToken, indent int) error {
+	var clause *sqlClause
+	contentIndent := indent
+	caseDepth := 0
+	inBetween := false
+	for i := 0; i < len(tokens); {
+		tok := tokens[i]
+		if tok.kind == sqlWord && caseDepth == 0 {
+			if c := matchSqlClause(tokens[i:], clause); c != nil {
+				p.newline(indent)
+				for _, kw := range tokens[i : i+len(c.keywords)] {
+					p.write(kw)
+				}
+				i += len(c.keywords)
+				clause = c
+				p.spaceBeforeParen = c.spaceBeforeParen
+				contentIndent = indent + 1
+				switch c.style {
+				case sqlBareClause:
+					contentIndent = indent
+				case sqlInlineClause:
+				default:
+					p.newline(contentIndent)
+				}
+				continue
+			}
+		}
+		switch {
+		case isSqlPunctuation(tok, "("):
+			end := matchingSqlParen(tokens, i)
+			if end < 0 {
+				return errors.Errorf("unable to parse %s: unbalanced parentheses", p.dialect.name)
+			}
+			inner := tokens[i+1 : end]
+			p.write(tok)
+			if isSqlSubquery(inner) {
+				if err := p.query(inner, contentIndent+1); err != nil {
+					return err
+				}
+				p.newline(contentIndent)
+			} else {
+				for _, t := range inner {
+					p.write(t)
+				}
+			}
+			p.write(tokens[end])
+			i = end + 1
+			continue
+		case isSqlPunctuation(tok, ")"):
+			return errors.Errorf("unable to parse %s: unbalanced parentheses", p.dialect.name)
+		case isSqlPunctuation(tok, "["):
+			// the subscripts and elements of arrays stay on one line
+			end := matchingSqlParen(tokens, i)
+			if end < 0 {
+				return errors.Errorf("unable to parse %s: unbalanced brackets", p.dialect.name)
+			}
+			for _, t := range tokens[i : end+1] {
+				p.write(t)
+			}
+			i = end + 1
+			continue
+		case isSqlPunctuation(tok, ","):
+			p.write(tok)
+			if clause != nil && (clause.style == sqlListClause || clause.style == sqlTableClause) {
+				p.newline(contentIndent)
+			}
+			i++
+			continue
+		case isSqlWord(tok, "CASE"):
+			caseDepth++
+		case isSqlWord(tok, "END") && caseDepth > 0:
+			caseDepth--
+		case isSqlWord(tok, "BETWEEN"):
+			inBetween = true
+		case isSqlWord(tok, "AND") && inBetween:
+			inBetween = false
+		case (isSqlWord(tok, "AND") || isSqlWord(tok, "OR")) && caseDepth == 0 && clause != nil &&
+			(clause.style == sqlConditionClause || clause.style == sqlTableClause):
+			p.newline(contentIndent)
+		case clause != nil && clause.style == sqlTableClause:
+			if n := sqlJoinLength(tokens[i:]); n > 0 {
+				p.newline(contentIndent)
+				for _, kw := range tokens[i : i+n] {
+					p.write(kw)
+				}
+				i += n
+				continue
+			}
+		}
+		p.write(tok)
+		i++
+	}
+	return nil
+}
+
+// followsObjectKeyword reports whether the name just written is that of a table in DDL, such as in REFERENCES t (id)
+func (p *sqlPrinter) followsObjectKeyword() bool {
+	return p.inDdl && p.beforeName != nil && p.beforeName.kind == sqlWord &&
+		sqlNamedObjectKeywords[strings.ToUpper(p.beforeName.text)]
+}
+
+// ddl lays out a schema statement.  The columns of CREATE TABLE and the actions of ALTER TABLE are written one per
+// line and the query of CREATE VIEW ... AS starts on a new line.  Everything else stays on the statement's line.
+func (p *sqlPrinter) ddl(tokens []sqlToken) error {
+	p.inDdl = true
+	createTable := isSqlWord(tokens[0], "CREATE") && sqlObjectType(tokens) == "TABLE"
+	alterTable := isSqlWord(tokens[0], "ALTER") && sqlObjectType(tokens) == "TABLE"
+	actionsStart := -1
+	if alterTable {
+		actionsStart = sqlAlterActionsStart(tokens)
+	}
+	for i := 0; i < len(tokens); {
+		tok := tokens[i]
+		switch {
+		case i == actionsStart:
+			p.newline(1)
+		case isSqlWord(tok, "SELECT") || isSqlWord(tok, "WITH") && i+1 < len(tokens) && tokens[i+1].kind == sqlWord:
+			return p.query(tokens[i:], 0)
+		case isSqlPunctuation(tok, "("):
+			end := matchingSqlParen(tokens, i)
+			if end < 0 {
+				return errors.Errorf("unable to parse %s: unbalanced parentheses", p.dialect.name)
+			}
+			p.write(tok)
+			if createTable {
+				createTable = false // only the first parentheses hold the columns
+				p.ddlList(tokens[i+1 : end])
+				p.newline(0)
+			} else {
+				for _, t := range tokens[i+1 : end] {
+					p.write(t)
+				}
+			}
+			p.write(tokens[end])
+			i = end + 1
+			continue
+		case isSqlPunctuation(tok, ")"):
+			return errors.Errorf("unable to parse %s: unbalanced parentheses", p.dialect.name)
+		case isSqlPunctuation(tok, ",") && alterTable:
+			p.write(tok)
+			p.newline(1)
+			i++
+			continue
+		}
+		p.write(tok)
+		i++
+	}
+	return nil
+}
+
+// ddlList writes the comma-separated definitions of a table, one per line
+func (p *sqlPrinter) ddlList(tokens []sqlToken) {
+	p.newline(1)
+	depth := 0
+	for _, tok := range tokens {
+		switch {
+		case isSqlPunctuation(tok, "("):
+			depth++
+		case isSqlPunctuation(tok, ")"):
+			depth--
+		}
+		p.write(tok)
+		if isSqlPunctuation(tok, ",") && depth == 0 {
+			p.newline(1)
+		}
+	}
+}
+
+// sqlObjectType returns the kind of object, such as TABLE or INDEX, that a DDL statement operates on
+func sqlObjectType(tokens []sqlToken) string {
+	for _, tok := range tokens[1:] {
+		if tok.kind != sqlWord {
+			break
+		}
+		switch upper := strings.ToUpper(tok.text); upper {
+		case "TABLE", "INDEX", "VIEW":
+			return upper
+		}
+	}
+	return ""
+}
+
+// sqlAlterActionsStart returns the index of the first action of ALTER TABLE [IF EXISTS] [ONLY] name, if any
+func sqlAlterActionsStart(tokens []sqlToken) int {
+	i := 2
+	for i < len(tokens) && (isSqlWord(tokens[i], "IF") || isSqlWord(tokens[i], "EXISTS") || isSqlWord(tokens[i], "ONLY")) {
+		i++
+	}
+	i++ // the table name
+	for i+1 < len(tokens) && isSqlPunctuation(tokens[i], ".") {
+		i += 2
+	}
+	if i >= len(tokens) {
+		return -1
+	}
+	return i
+}
+
+// isSqlDdl reports whether a statement defines the schema
+func isSqlDdl(tokens []sqlToken) bool {
+	return tokens[0].kind == sqlWord && sqlDdlKeywords[strings.ToUpper(tokens[0].text)]
+}
+
+func matchSqlClause(tokens []sqlToken, current *sqlClause) *sqlClause {
+	currentName := ""
+	if current != nil {
+		currentName = current.name()
+	}
+Clauses:
+	for _, c := range sqlClauses {
+		if len(tokens) < len(c.keywords) {
+			continue
+		}
+		for i, kw := range c.keywords {
+			if !isSqlWord(tokens[i], kw) {
+				continue Clauses
+			}
+		}
+		if c.after == nil {
+			return c
+		}
+		for _, a := range c.after {
+			if a == currentName {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// sqlJoinLength returns the number of words that make up the join keyword at the start of "tokens", if any
+func sqlJoinLength(tokens []sqlToken) int {
+	for i, tok := range tokens {
+		switch {
+		case isSqlWord(tok, "JOIN"), isSqlWord(tok, "STRAIGHT_JOIN"):
+			return i + 1
+		case tok.kind != sqlWord || !sqlJoinModifiers[strings.ToUpper(tok.text)]:
+			return 0
+		}
+	}
+	return 0
+}
+
+// matchingSqlParen returns the index of the parenthesis or bracket that closes the one at "open", or -1 if there is none
+func matchingSqlParen(tokens []sqlToken, open int) int {
+	opening, closing := "(", ")"
+	if isSqlPunctuation(tokens[open], "[") {
+		opening, closing = "[", "]"
+	}
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch {
+		case isSqlPunctuation(tokens[i], opening):
+			depth++
+		case isSqlPunctuation(tokens[i], closing):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isSqlSubquery(tokens []sqlToken) bool {
+	for _, tok := range tokens {
+		if tok.kind == sqlLineComment || tok.kind == sqlBlockComment {
+			continue
+		}
+		return isSqlWord(tok, "SELECT") || isSqlWord(tok, "WITH")
+	}
+	return false
+}
+
+func isSqlWord(tok sqlToken, word string) bool {
+	return tok.kind == sqlWord && strings.EqualFold(tok.text, word)
+}
+
+func isSqlPunctuation(tok sqlToken, text string) bool {
+	return tok.kind == sqlPunctuation && tok.text == text
+}
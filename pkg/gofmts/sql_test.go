@@ -0,0 +1,293 @@
+package gofmts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlFormatter(t *testing.T) {
+	cases := []struct {
+		name     string
+		dialect  *sqlDialect
+		input    string
+		expected string
+	}{
+		{
+			name:     "simple select matches postgresql layout",
+			dialect:  mysqlDialect,
+			input:    "select * from mytable",
+			expected: "SELECT\n  *\nFROM\n  mytable",
+		},
+		{
+			name:    "mysql identifiers, between and limit with offset",
+			dialect: mysqlDialect,
+			input:   "SELECT `id`, `name` FROM `users` WHERE `age` BETWEEN 18 AND 30 AND active = 1 LIMIT 10, 20",
+			expected: "SELECT\n  `id`,\n  `name`\nFROM\n  `users`\nWHERE\n  `age` BETWEEN 18 AND 30\n  AND active = 1\n" +
+				"LIMIT 10, 20",
+		},
+		{
+			name:    "mysql insert with on duplicate key update",
+			dialect: mysqlDialect,
+			input:   `insert into t (a, b) values (1, 'x'), (2, "y") on duplicate key update b = values(b), a = a + 1`,
+			expected: "INSERT INTO\n  t (a, b)\nVALUES\n  (1, 'x'),\n  (2, \"y\")\nON DUPLICATE KEY UPDATE\n" +
+				"  b = VALUES(b),\n  a = a + 1",
+		},
+		{
+			name:     "mysql update with placeholder",
+			dialect:  mysqlDialect,
+			input:    "update t set a = 1, b = -2 where id = ?",
+			expected: "UPDATE\n  t\nSET\n  a = 1,\n  b = -2\nWHERE\n  id = ?",
+		},
+		{
+			name:    "joins and subqueries",
+			dialect: mysqlDialect,
+			input:   "select a from t left join u on t.id = u.id and u.x > 1 where a in (select b from v) for update",
+			expected: "SELECT\n  a\nFROM\n  t\n  LEFT JOIN u ON t.id = u.id\n  AND u.x > 1\nWHERE\n  a IN (\n    SELECT\n" +
+				"      b\n    FROM\n      v\n  )\nFOR UPDATE",
+		},
+		{
+			name:     "comments are preserved",
+			dialect:  mysqlDialect,
+			input:    "select a, -- first\n b /* second */ from t # trailing",
+			expected: "SELECT\n  a, -- first\n  b /* second */\nFROM\n  t # trailing",
+		},
+		{
+			name:    "sqlite identifiers and parameters",
+			dialect: sqliteDialect,
+			input:   `select [a], "b" from t where x = :x and y = @y and z = $z and w = ?1`,
+			expected: "SELECT\n  [a],\n  \"b\"\nFROM\n  t\nWHERE\n  x = :x\n  AND y = @y\n  AND z = $z\n" +
+				"  AND w = ?1",
+		},
+		{
+			name:    "sqlite recursive common table expression",
+			dialect: sqliteDialect,
+			input:   "with recursive cnt(x) as (select 1 union all select x + 1 from cnt limit 10) select x from cnt",
+			expected: "WITH RECURSIVE\n  cnt(x) AS (\n    SELECT\n      1\n    UNION ALL\n    SELECT\n      x + 1\n" +
+				"    FROM\n      cnt\n    LIMIT 10\n  )\nSELECT\n  x\nFROM\n  cnt",
+		},
+		{
+			name:    "create table lists one column per line",
+			dialect: mysqlDialect,
+			input: "create table if not exists users (id int auto_increment primary key, name varchar(255) not null,\n" +
+				"-- the owner\n org_id int references orgs (id) on delete cascade, unique key (name, org_id)) engine=InnoDB",
+			expected: "CREATE TABLE IF NOT EXISTS users (\n  id INT AUTO_INCREMENT PRIMARY KEY,\n" +
+				"  name VARCHAR(255) NOT NULL,\n  -- the owner\n  org_id INT REFERENCES orgs (id) ON DELETE CASCADE,\n" +
+				"  UNIQUE KEY (name, org_id)\n) engine = InnoDB",
+		},
+		{
+			name:     "alter table lists one action per line",
+			dialect:  sqliteDialect,
+			input:    "alter table main.users add column age integer default 0, drop column legacy",
+			expected: "ALTER TABLE main.users\n  ADD COLUMN age INTEGER DEFAULT 0,\n  DROP COLUMN legacy",
+		},
+		{
+			name:    "scripts keep the comments between statements",
+			dialect: mysqlDialect,
+			input: "-- +migrate Up\ncreate index users_name on users (name); -- for lookups\n" +
+				"/* seed */ insert into users (name) values ('admin');\ndrop view if exists v;\n-- the end\n",
+			expected: "-- +migrate Up\nCREATE INDEX users_name ON users (name); -- for lookups\n\n" +
+				"/* seed */\nINSERT INTO\n  users (name)\nVALUES\n  ('admin');\n\nDROP VIEW IF EXISTS v;\n\n-- the end",
+		},
+		{
+			name:    "keywords used as identifiers keep their case",
+			dialect: mysqlDialect,
+			input:   "select id, text, key from notes where mode = 1 and text like 'a%' order by key lock in share mode",
+			expected: "SELECT\n  id,\n  text,\n  key\nFROM\n  notes\nWHERE\n  mode = 1\n  AND text LIKE 'a%'\nORDER BY\n  key\n" +
+				"LOCK IN SHARE MODE",
+		},
+		{
+			name:     "types are only normalized where a type is expected",
+			dialect:  mysqlDialect,
+			input:    "create table notes (id int primary key, text text not null, mode double precision)",
+			expected: "CREATE TABLE notes (\n  id INT PRIMARY KEY,\n  text TEXT NOT NULL,\n  mode DOUBLE PRECISION\n)",
+		},
+		{
+			name:     "casts name types",
+			dialect:  mysqlDialect,
+			input:    "select cast(text as text), text as text from notes",
+			expected: "SELECT\n  CAST(text AS TEXT),\n  text AS text\nFROM\n  notes",
+		},
+		{
+			name:    "scripts are not split inside the body of a trigger",
+			dialect: mysqlDialect,
+			input: "create trigger notes_mode before insert on notes for each row begin if new.mode is null then " +
+				"set new.mode = 1; end if; set new.key = case when new.id then 2 end; end; begin; select 1;",
+			expected: "CREATE trigger notes_mode before INSERT ON notes FOR each row BEGIN IF new.mode IS NULL THEN " +
+				"SET new.mode = 1; END IF; SET new.key = CASE WHEN new.id THEN 2 END; END;\n\nBEGIN;\n\nSELECT\n  1;",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			out, err := sqlFormatter{dialect: c.dialect}.Format(c.input, DirectiveOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, out)
+		})
+	}
+
+	t.Run("postgresql arrays and jsonb operators", func(t *testing.T) {
+		operators := []struct {
+			name     string
+			input    string
+			expected string
+		}{
+			{name: "array subscript", input: "select a[1] from t", expected: "SELECT\n  a[1]\nFROM\n  t"},
+			{name: "array slice", input: "select a[1:2] from t", expected: "SELECT\n  a[1:2]\nFROM\n  t"},
+			{name: "contains", input: "select * from t where data @> '{\"a\": 1}'",
+				expected: "SELECT\n  *\nFROM\n  t\nWHERE\n  data @> '{\"a\": 1}'"},
+			{name: "contained by", input: "select * from t where data <@ '{}'",
+				expected: "SELECT\n  *\nFROM\n  t\nWHERE\n  data <@ '{}'"},
+			{name: "any key exists", input: "select * from t where data ?| array['a', 'b']",
+				expected: "SELECT\n  *\nFROM\n  t\nWHERE\n  data ?| ARRAY['a', 'b']"},
+			{name: "all keys exist", input: "select * from t where data ?& array['a']",
+				expected: "SELECT\n  *\nFROM\n  t\nWHERE\n  data ?& ARRAY['a']"},
+			{name: "path", input: "select data #> '{a,b}' from t", expected: "SELECT\n  data #> '{a,b}'\nFROM\n  t"},
+			{name: "path as text", input: "select data #>> '{a,b}' from t", expected: "SELECT\n  data #>> '{a,b}'\nFROM\n  t"},
+		}
+		registry := NewRegistry()
+		for _, directive := range []string{"sql", "postgresql"} {
+			formatter, ok := registry.Lookup(directive)
+			require.True(t, ok)
+			for _, c := range operators {
+				out, err := formatter.Format(c.input, DirectiveOptions{})
+				require.NoError(t, err, "%s: %s", directive, c.name)
+				assert.Equal(t, c.expected, out, "%s: %s", directive, c.name)
+			}
+		}
+	})
+
+	t.Run("array subscripts are kept together alongside comments", func(t *testing.T) {
+		out, err := sqlFormatter{dialect: postgresqlDialect}.Format(
+			"select a[1], b[2:3], array[1, 2] -- x\nfrom t", DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT\n  a[1],\n  b[2:3],\n  ARRAY[1, 2] -- x\nFROM\n  t", out)
+	})
+
+	t.Run("placeholders are preserved by postgresql", func(t *testing.T) {
+		out, err := sqlFormatter{dialect: postgresqlDialect}.Format(
+			"select * from {{ .Table }} where a = $1 and c = :c and d = @p1 and e in (%s) limit %d",
+			DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT\n  *\nFROM\n  {{ .Table }}\nWHERE\n  a = $1\n  AND c = :c\n  AND d = @p1\n"+
+			"  AND e IN (%s)\nLIMIT %d", out)
+	})
+
+	t.Run("postgresql scripts mix schema changes and queries", func(t *testing.T) {
+		out, err := sqlFormatter{dialect: postgresqlDialect}.Format(
+			"create view active_users as select * from users where active;\n-- check\nselect count(*) from active_users;",
+			DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "CREATE VIEW active_users AS\nSELECT\n  *\nFROM\n  users\nWHERE\n  active;\n\n"+
+			"-- check\nSELECT\n  count(*)\nFROM\n  active_users;", out)
+	})
+
+	t.Run("postgresql statements keep their comments", func(t *testing.T) {
+		out, err := sqlFormatter{dialect: postgresqlDialect}.Format(
+			"select a, -- first\n b from t where a = 'x' -- trailing\n", DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT\n  a, -- first\n  b\nFROM\n  t\nWHERE\n  a = 'x' -- trailing", out)
+	})
+
+	t.Run("the postgresql parser is only given statements that end with a newline", func(t *testing.T) {
+		_, err := renderPostgresql("select 1 -- unterminated", true) // the parser's lexer would never finish this
+		require.Error(t, err)
+		assert.Equal(t, "unable to parse sql: statement must end with a newline", err.Error())
+
+		out, err := renderPostgresql("select 1 -- terminated\n", true)
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT\n  1\n", out)
+	})
+
+	t.Run("errors name the statement that failed", func(t *testing.T) {
+		_, err := sqlFormatter{dialect: mysqlDialect}.Format("select 1; select (a from t;", DirectiveOptions{})
+		require.Error(t, err)
+		assert.Equal(t, "statement 2: unable to parse mysql: unbalanced parentheses", err.Error())
+	})
+
+	t.Run("placeholders are preserved by mysql", func(t *testing.T) {
+		out, err := sqlFormatter{dialect: mysqlDialect}.Format(
+			"select a %% 2 from {{.Table}} where a = ? and b = :b and c like '%s' limit %[2]d", DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT\n  a %% 2\nFROM\n  {{.Table}}\nWHERE\n  a = ?\n  AND b = :b\n  AND c LIKE '%s'\n"+
+			"LIMIT %[2]d", out)
+	})
+
+	t.Run("casts are not named placeholders", func(t *testing.T) {
+		tokens, err := lexSql(postgresqlDialect, "a::int")
+		require.NoError(t, err)
+		require.Len(t, tokens, 3)
+		assert.Equal(t, "::", tokens[1].text)
+	})
+
+	t.Run("modulo is not a format verb", func(t *testing.T) {
+		tokens, err := lexSql(mysqlDialect, "a % b")
+		require.NoError(t, err)
+		require.Len(t, tokens, 3)
+		assert.Equal(t, sqlOperator, tokens[1].kind)
+	})
+
+	t.Run("percent signs after an operand are modulo", func(t *testing.T) {
+		cases := []struct {
+			dialect  *sqlDialect
+			input    string
+			expected string
+		}{
+			{dialect: postgresqlDialect, input: "select a % b from t", expected: "SELECT\n  a % b\nFROM\n  t"},
+			{dialect: postgresqlDialect, input: "select a %b from t", expected: "SELECT\n  a % b\nFROM\n  t"},
+			{dialect: postgresqlDialect, input: "select (a) %b, %s from t", expected: "SELECT\n  (a) % b,\n  %s\nFROM\n  t"},
+			{dialect: mysqlDialect, input: "select a %b from t where c = %d", expected: "SELECT\n  a % b\nFROM\n  t\nWHERE\n  c = %d"},
+		}
+		for _, c := range cases {
+			out, err := sqlFormatter{dialect: c.dialect}.Format(c.input, DirectiveOptions{})
+			require.NoError(t, err, c.input)
+			assert.Equal(t, c.expected, out, c.input)
+		}
+	})
+
+	t.Run("question marks are only parameters in dialects that use them", func(t *testing.T) {
+		out, err := sqlFormatter{dialect: postgresqlDialect}.Format("select * from t where data ? 'k'", DirectiveOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT\n  *\nFROM\n  t\nWHERE\n  data ? 'k'", out)
+
+		tokens, err := lexSql(postgresqlDialect, "data ? 'k'")
+		require.NoError(t, err)
+		require.Len(t, tokens, 3)
+		assert.Equal(t, sqlOperator, tokens[1].kind)
+
+		tokens, err = lexSql(sqliteDialect, "a = ?")
+		require.NoError(t, err)
+		require.Len(t, tokens, 3)
+		assert.Equal(t, sqlPlaceholder, tokens[2].kind)
+	})
+
+	t.Run("unterminated template actions are rejected", func(t *testing.T) {
+		_, err := lexSql(mysqlDialect, "select {{.Columns")
+		require.Error(t, err)
+		assert.Equal(t, "unable to parse mysql at character 8: unterminated template action", err.Error())
+	})
+
+	t.Run("keywords can be lower case", func(t *testing.T) {
+		out, err := sqlFormatter{dialect: mysqlDialect}.Format("SELECT a FROM t", DirectiveOptions{"case": "lower"})
+		require.NoError(t, err)
+		assert.Equal(t, "select\n  a\nfrom\n  t", out)
+	})
+
+	t.Run("unterminated strings are rejected", func(t *testing.T) {
+		_, err := sqlFormatter{dialect: sqliteDialect}.Format("select 'unterminated", DirectiveOptions{})
+		require.Error(t, err)
+		assert.Equal(t, "unable to parse sqlite at character 8: unterminated string", err.Error())
+	})
+
+	t.Run("unbalanced parentheses are rejected", func(t *testing.T) {
+		_, err := sqlFormatter{dialect: mysqlDialect}.Format("select (a from t", DirectiveOptions{})
+		require.Error(t, err)
+		assert.Equal(t, "unable to parse mysql: unbalanced parentheses", err.Error())
+	})
+
+	t.Run("backticks are not identifiers in postgresql", func(t *testing.T) {
+		_, err := lexSql(postgresqlDialect, "select `a`")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,345 @@
+package gofmts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// sqlDialect describes the lexical differences between the SQL dialects we format
+type sqlDialect struct {
+	name                string
+	identifierQuotes    string // characters that open a quoted identifier ('[' is closed by ']')
+	stringQuotes        string // characters that open a string
+	backslashEscapes    bool   // strings may contain backslash escapes
+	hashComments        bool   // '#' starts a comment
+	dollarQuotedStrings bool   // strings may be quoted with $tag$ ... $tag$
+	nestedBlockComments bool   // /* ... */ comments may be nested
+	questionParameters  bool   // '?' is a query parameter rather than an operator
+}
+
+var (
+	mysqlDialect = &sqlDialect{
+		name:               "mysql",
+		identifierQuotes:   "`",
+		stringQuotes:       `'"`,
+		backslashEscapes:   true,
+		hashComments:       true,
+		questionParameters: true,
+	}
+	postgresqlDialect = &sqlDialect{
+		name:                "postgresql",
+		identifierQuotes:    `"`,
+		stringQuotes:        "'",
+		dollarQuotedStrings: true,
+		nestedBlockComments: true,
+	}
+	sqliteDialect = &sqlDialect{
+		name:               "sqlite",
+		identifierQuotes:   "\"`[",
+		stringQuotes:       "'",
+		questionParameters: true,
+	}
+)
+
+type sqlTokenKind int
+
+const (
+	sqlWord sqlTokenKind = iota
+	sqlQuotedIdentifier
+	sqlString
+	sqlNumber
+	sqlOperator
+	sqlPunctuation // one of ( ) [ ] , ; .
+	sqlLineComment
+	sqlBlockComment
+	sqlPlaceholder // a query parameter or a hole to be filled by fmt or text/template, which is kept verbatim
+)
+
+type sqlToken struct {
+	kind   sqlTokenKind
+	text   string
+	offset int
+	// newlineBefore records whether the token was preceded by a line break in the input
+	newlineBefore bool
+}
+
+// sqlOperators lists multi-character operators, longest first, including the jsonb and array operators of postgresql
+var sqlOperators = []string{"->>", "<=>", "#>>", "::", "<=", ">=", "<>", "!=", "||", "&&", "<<", ">>", "->", ":=", "@>",
+	"<@", "?|", "?&", "#>"}
+
+type sqlLexer struct {
+	dialect      *sqlDialect
+	input        string
+	pos          int
+	afterOperand bool // the last token ends an operand, so a following '%' is an operator rather than a fmt verb
+}
+
+func lexSql(dialect *sqlDialect, input string) ([]sqlToken, error) {
+	l := sqlLexer{dialect: dialect, input: input}
+	var tokens []sqlToken
+	for {
+		newline := l.skipSpace()
+		if l.pos >= len(l.input) {
+			return tokens, nil
+		}
+		start := l.pos
+		kind, err := l.next()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse %s at character %d", dialect.name, start+1)
+		}
+		tok := sqlToken{kind: kind, text: l.input[start:l.pos], offset: start, newlineBefore: newline}
+		if kind != sqlLineComment && kind != sqlBlockComment {
+			l.afterOperand = endsSqlOperand(tok)
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// endsSqlOperand reports whether "tok" may be the end of an operand, such as a column name or a closing parenthesis.
+// Placeholders don't count, since they may stand for keywords, as in ORDER BY %s %s.
+func endsSqlOperand(tok sqlToken) bool {
+	switch tok.kind {
+	case sqlWord:
+		return !sqlKeywords[strings.ToUpper(tok.text)]
+	case sqlQuotedIdentifier, sqlString, sqlNumber:
+		return true
+	case sqlPunctuation:
+		return tok.text == ")" || tok.text == "]"
+	}
+	return false
+}
+
+func (l *sqlLexer) skipSpace() (sawNewline bool) {
+	for l.pos < len(l.input) {
+		r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		if r == '\n' {
+			sawNewline = true
+		}
+		l.pos += size
+	}
+	return sawNewline
+}
+
+func (l *sqlLexer) peek(offset int) byte {
+	if l.pos+offset < len(l.input) {
+		return l.input[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *sqlLexer) next() (sqlTokenKind, error) {
+	c := l.peek(0)
+	switch {
+	case c == '-' && l.peek(1) == '-', c == '#' && l.dialect.hashComments:
+		l.skipLine()
+		return sqlLineComment, nil
+	case c == '/' && l.peek(1) == '*':
+		return sqlBlockComment, l.skipBlockComment()
+	case strings.IndexByte(l.dialect.stringQuotes, c) >= 0:
+		return sqlString, l.skipQuoted(c, l.dialect.backslashEscapes)
+	case (c == 'E' || c == 'e') && l.peek(1) == '\'' && l.dialect == postgresqlDialect:
+		l.pos++
+		return sqlString, l.skipQuoted('\'', true)
+	case strings.IndexByte(l.dialect.identifierQuotes, c) >= 0:
+		if c == '[' {
+			return sqlQuotedIdentifier, l.skipUntil("]", "unterminated quoted identifier")
+		}
+		return sqlQuotedIdentifier, l.skipQuoted(c, false)
+	case c == '$' && l.dialect.dollarQuotedStrings && l.isDollarQuote():
+		return sqlString, l.skipDollarQuoted()
+	case c == '{' && l.peek(1) == '{':
+		return sqlPlaceholder, l.skipUntil("}}", "unterminated template action")
+	case c == '?' && l.dialect.questionParameters, c == '$' && isDigit(l.peek(1)):
+		// positional parameters: ?, ?1, $1
+		l.pos++
+		for isDigit(l.peek(0)) {
+			l.pos++
+		}
+		return sqlPlaceholder, nil
+	case (c == ':' || c == '@' || c == '$') && isWordStart(l.peek(1)):
+		// named parameters: :name, @name, $name
+		l.pos++
+		l.skipWord()
+		return sqlPlaceholder, nil
+	case c == '%' && (!l.afterOperand || l.peek(1) == '%') && l.skipFormatVerb():
+		// a fmt verb, where an operand is expected
+		return sqlPlaceholder, nil
+	case c == '@' && l.dialect == mysqlDialect:
+		// user and system variables
+		l.pos++
+		if l.peek(0) == '@' {
+			l.pos++
+		}
+		l.skipWord()
+		return sqlWord, nil
+	case isDigit(c) || c == '.' && isDigit(l.peek(1)):
+		l.skipNumber()
+		return sqlNumber, nil
+	case isWordStart(c) || c >= utf8.RuneSelf && l.isLetter():
+		l.skipWord()
+		return sqlWord, nil
+	case strings.IndexByte("()[],;.", c) >= 0:
+		l.pos++
+		return sqlPunctuation, nil
+	}
+	for _, op := range sqlOperators {
+		if strings.HasPrefix(l.input[l.pos:], op) {
+			l.pos += len(op)
+			return sqlOperator, nil
+		}
+	}
+	if strings.IndexByte("+-*/%=<>!|&^~?:", c) >= 0 {
+		l.pos++
+		return sqlOperator, nil
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+	return 0, errors.Errorf("unexpected character %q", r)
+}
+
+func (l *sqlLexer) isLetter() bool {
+	r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
+	return unicode.IsLetter(r)
+}
+
+func (l *sqlLexer) skipLine() {
+	for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+		l.pos++
+	}
+}
+
+func (l *sqlLexer) skipBlockComment() error {
+	depth := 0
+	for l.pos < len(l.input) {
+		switch {
+		case strings.HasPrefix(l.input[l.pos:], "/*"):
+			if depth == 0 || l.dialect.nestedBlockComments {
+				depth++
+			}
+			l.pos += 2
+		case strings.HasPrefix(l.input[l.pos:], "*/"):
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				return nil
+			}
+		default:
+			l.pos++
+		}
+	}
+	return errors.New("unterminated comment")
+}
+
+// skipQuoted skips a quoted string or identifier, in which the quote may be escaped by doubling it
+func (l *sqlLexer) skipQuoted(quote byte, backslashEscapes bool) error {
+	l.pos++
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case c == '\\' && backslashEscapes:
+			l.pos += 2
+		case c == quote && l.peek(1) == quote:
+			l.pos += 2
+		case c == quote:
+			l.pos++
+			return nil
+		default:
+			l.pos++
+		}
+	}
+	if strings.IndexByte(l.dialect.stringQuotes, quote) >= 0 {
+		return errors.New("unterminated string")
+	}
+	return errors.New("unterminated quoted identifier")
+}
+
+func (l *sqlLexer) skipUntil(end string, unterminated string) error {
+	i := strings.Index(l.input[l.pos:], end)
+	if i < 0 {
+		return errors.New(unterminated)
+	}
+	l.pos += i + len(end)
+	return nil
+}
+
+// formatVerbPattern matches the verbs used by fmt.Sprintf, such as %s, %d, %-10v and %[2]q
+var formatVerbPattern = regexp.MustCompile(`^%(%|[-+#0]*(\[\d+\])?\d*(\.\d+)?[a-zA-Z])`)
+
+func (l *sqlLexer) skipFormatVerb() bool {
+	verb := formatVerbPattern.FindString(l.input[l.pos:])
+	l.pos += len(verb)
+	return verb != ""
+}
+
+func (l *sqlLexer) isDollarQuote() bool {
+	i := 1
+	for l.pos+i < len(l.input) && isWordStart(l.input[l.pos+i]) {
+		i++
+	}
+	return l.peek(i) == '$'
+}
+
+func (l *sqlLexer) skipDollarQuoted() error {
+	end := strings.IndexByte(l.input[l.pos+1:], '$') + 2
+	tag := l.input[l.pos : l.pos+end]
+	l.pos += end
+	i := strings.Index(l.input[l.pos:], tag)
+	if i < 0 {
+		return errors.New("unterminated string")
+	}
+	l.pos += i + len(tag)
+	return nil
+}
+
+func (l *sqlLexer) skipNumber() {
+	if l.peek(0) == '0' && (l.peek(1) == 'x' || l.peek(1) == 'X') {
+		l.pos += 2
+		for isHexDigit(l.peek(0)) {
+			l.pos++
+		}
+		return
+	}
+	for isDigit(l.peek(0)) || l.peek(0) == '.' {
+		l.pos++
+	}
+	if c := l.peek(0); c == 'e' || c == 'E' {
+		offset := 1
+		if sign := l.peek(1); sign == '+' || sign == '-' {
+			offset++
+		}
+		if isDigit(l.peek(offset)) {
+			l.pos += offset
+			for isDigit(l.peek(0)) {
+				l.pos++
+			}
+		}
+	}
+}
+
+func (l *sqlLexer) skipWord() {
+	for l.pos < len(l.input) {
+		r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+		if r != '_' && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return
+		}
+		l.pos += size
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}